@@ -0,0 +1,350 @@
+// Package admin serves a read-only HTTP API over the recordings, for
+// scripting against a running MIRRA instead of running the CLI on its host,
+// and a web UI for browsing them. It shares its queries with the CLI
+// commands.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llmite-ai/mirra/internal/commands"
+	"github.com/llmite-ai/mirra/internal/config"
+	"github.com/llmite-ai/mirra/internal/recorder"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 1000
+)
+
+// keepAliveInterval is how often an idle tail stream sends a comment so
+// proxies and clients don't time it out
+const keepAliveInterval = 15 * time.Second
+
+type API struct {
+	token          string
+	recordingsPath string
+	recorder       *recorder.Recorder
+	handler        http.Handler
+
+	// done ends open tail streams on shutdown
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New returns the admin API for the recordings in recordingsPath. New
+// recordings are streamed from rec. A non-nil metrics handler is served at
+// /metrics, behind the same token as the API.
+func New(cfg config.AdminConfig, recordingsPath string, rec *recorder.Recorder, metrics http.Handler) *API {
+	api := &API{
+		token:          cfg.Token,
+		recordingsPath: recordingsPath,
+		recorder:       rec,
+		done:           make(chan struct{}),
+	}
+
+	apiMux := http.NewServeMux()
+	apiMux.HandleFunc("GET /api/recordings", api.listRecordings)
+	apiMux.HandleFunc("GET /api/recordings/{id}", api.getRecording)
+	apiMux.HandleFunc("GET /api/recordings/{id}/transcript", api.getTranscript)
+	apiMux.HandleFunc("GET /api/stats", api.stats)
+	apiMux.HandleFunc("GET /api/tail", api.tail)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/", api.authenticate(apiMux))
+	if metrics != nil {
+		mux.Handle("GET /metrics", api.authenticate(metrics))
+	}
+	mux.Handle("GET /", uiHandler())
+	api.handler = mux
+	return api
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.handler.ServeHTTP(w, r)
+}
+
+// Close ends open tail streams, which would otherwise hold up a graceful
+// shutdown
+func (a *API) Close() {
+	a.closeOnce.Do(func() { close(a.done) })
+}
+
+// authenticate requires the configured token as a bearer token
+func (a *API) authenticate(next http.Handler) http.Handler {
+	if a.token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mirra admin"`)
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listRecordings returns matching recordings, newest first
+func (a *API) listRecordings(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := intParam(r, "limit", defaultLimit)
+	if err != nil || limit < 1 || limit > maxLimit {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxLimit))
+		return
+	}
+	offset, err := intParam(r, "offset", 0)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "offset must not be negative")
+		return
+	}
+
+	// Read the daily files newest first and stop once there is more than
+	// this page, so paging through recent recordings doesn't read them all.
+	// total is then only a lower bound.
+	files, err := commands.RecordingFiles(a.recordingsPath)
+	if err != nil && !errors.Is(err, commands.ErrNoRecordings) {
+		a.internalError(w, err)
+		return
+	}
+	summaries := []commands.Summary{}
+	exact := true
+	for i := len(files) - 1; i >= 0; i-- {
+		var day []commands.Summary
+		_, err := commands.ScanFile(files[i], filter, func(rec *recorder.Recording, _ []byte) bool {
+			day = append(day, commands.Summarize(rec))
+			return true
+		})
+		if err != nil {
+			a.internalError(w, err)
+			return
+		}
+		sort.SliceStable(day, func(i, j int) bool {
+			return day[i].Timestamp.After(day[j].Timestamp)
+		})
+		summaries = append(summaries, day...)
+		if len(summaries) > offset+limit && i > 0 {
+			exact = false
+			break
+		}
+	}
+
+	total := len(summaries)
+	page := summaries[min(offset, total):min(offset+limit, total)]
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"recordings":  page,
+		"total":       total,
+		"total_exact": exact,
+		"offset":      offset,
+		"limit":       limit,
+	})
+}
+
+// getRecording returns one recording by ID or unique ID prefix, with
+// credentials in its headers and query replaced as view does. raw=true
+// returns them unredacted, but only when the API requires a token.
+func (a *API) getRecording(w http.ResponseWriter, r *http.Request) {
+	raw, err := boolParam(r, "raw")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "raw must be true or false")
+		return
+	}
+	if raw && a.token == "" {
+		writeError(w, http.StatusForbidden, "raw recordings require admin.token to be set")
+		return
+	}
+
+	rec, ok := a.findRecording(w, r)
+	if !ok {
+		return
+	}
+	if !raw {
+		commands.Redact(rec)
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// getTranscript returns a recording as a commands.Transcript, the turns the
+// UI renders, so only the Go code needs to know the providers' formats
+func (a *API) getTranscript(w http.ResponseWriter, r *http.Request) {
+	rec, ok := a.findRecording(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, commands.NewTranscript(rec))
+}
+
+// findRecording looks up the recording named by the id path value, writing
+// the error response if there is none
+func (a *API) findRecording(w http.ResponseWriter, r *http.Request) (*recorder.Recording, bool) {
+	rec, err := commands.FindRecording(a.recordingsPath, r.PathValue("id"), commands.Filter{})
+	var ambiguous *commands.AmbiguousIDError
+	switch {
+	case errors.As(err, &ambiguous):
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"error":   ambiguous.Error(),
+			"matches": ambiguous.Matches,
+		})
+	case errors.Is(err, commands.ErrNotFound), errors.Is(err, commands.ErrNoRecordings):
+		writeError(w, http.StatusNotFound, "recording not found")
+	case err != nil:
+		a.internalError(w, err)
+	default:
+		return rec, true
+	}
+	return nil, false
+}
+
+func (a *API) stats(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stats, err := commands.CollectStats(a.recordingsPath, filter)
+	if errors.Is(err, commands.ErrNoRecordings) {
+		stats, err = &commands.Statistics{StopReasons: map[string]int64{}, ByProvider: map[string]*commands.ProviderStats{}}, nil
+	}
+	if err != nil {
+		a.internalError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// tail streams recordings as they are completed, as server-sent events
+// carrying a commands.TailEvent
+func (a *API) tail(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	recordings, unsubscribe := a.recorder.Subscribe()
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-a.done:
+			return
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			rc.Flush()
+		case rec := <-recordings:
+			var raw []byte
+			if filter.Query != "" {
+				raw, _ = json.Marshal(rec)
+			}
+			if !filter.Match(&rec, raw) {
+				continue
+			}
+
+			data, err := json.Marshal(commands.NewTailEvent(&rec))
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: recording\nid: %s\ndata: %s\n\n", rec.ID, data); err != nil {
+				return
+			}
+			rc.Flush()
+		}
+	}
+}
+
+// parseFilter reads the provider, model, status, q, where, from and to query
+// parameters; provider, model and status are shorthands for where
+// comparisons. Dates are YYYY-MM-DD (to includes the whole day) or RFC 3339.
+func parseFilter(r *http.Request) (commands.Filter, error) {
+	q := r.URL.Query()
+	filter := commands.Filter{Query: q.Get("q")}
+
+	where, err := commands.ParseFilters(q.Get("where"), q.Get("provider"), q.Get("model"), q.Get("status"))
+	if err != nil {
+		return filter, err
+	}
+	filter.Where = where
+
+	if from := q.Get("from"); from != "" {
+		t, err := commands.ParseDate(from)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from date %q", from)
+		}
+		filter.From = t
+	}
+	if to := q.Get("to"); to != "" {
+		t, err := commands.ParseDate(to)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to date %q", to)
+		}
+		if len(to) == len("2006-01-02") {
+			t = t.Add(24 * time.Hour) // Include the entire day
+		}
+		filter.To = t
+	}
+	return filter, nil
+}
+
+func intParam(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func boolParam(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+func (a *API) internalError(w http.ResponseWriter, err error) {
+	slog.Error("admin API request failed", "error", err)
+	writeError(w, http.StatusInternalServerError, "failed to read recordings")
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Debug("failed to write admin API response", "error", err)
+	}
+}
@@ -0,0 +1,22 @@
+package admin
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// The web UI is plain HTML, CSS and JavaScript with no build step. It is
+// served without authentication; the data it shows comes from the API,
+// which checks the token.
+//
+//go:embed ui
+var uiFiles embed.FS
+
+func uiHandler() http.Handler {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err) // the embedded directory always exists
+	}
+	return http.FileServerFS(files)
+}
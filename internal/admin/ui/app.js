@@ -0,0 +1,312 @@
+// The recordings browser. It is served by the admin listener and reads
+// everything through the admin API, sending the token saved in local storage.
+"use strict";
+
+const pageSize = 50;
+const tokenKey = "mirra.adminToken";
+
+const $ = (selector) => document.querySelector(selector);
+
+let offset = 0;
+
+// el creates an element with the given class and text or children
+function el(tag, className, content) {
+  const node = document.createElement(tag);
+  if (className) node.className = className;
+  if (Array.isArray(content)) node.append(...content.filter((c) => c != null));
+  else if (content != null) node.textContent = content;
+  return node;
+}
+
+async function api(path) {
+  const headers = {};
+  const token = localStorage.getItem(tokenKey);
+  if (token) headers.Authorization = `Bearer ${token}`;
+
+  const resp = await fetch(path, { headers });
+  if (resp.status === 401) {
+    if (askForToken()) return api(path);
+    throw new Error("The admin API needs a token. Set one with the 🔑 button.");
+  }
+  const body = await resp.json();
+  if (!resp.ok) throw new Error(body.error || `${resp.status} ${resp.statusText}`);
+  return body;
+}
+
+function askForToken() {
+  const token = prompt("Admin API token", localStorage.getItem(tokenKey) || "");
+  if (token === null) return false;
+  if (token) localStorage.setItem(tokenKey, token);
+  else localStorage.removeItem(tokenKey);
+  return true;
+}
+
+function showMessage(message) {
+  $("#message").textContent = message;
+  $("#message").hidden = !message;
+}
+
+function formatDuration(ms) {
+  if (ms == null) return "";
+  return ms >= 1000 ? `${(ms / 1000).toFixed(2)}s` : `${ms}ms`;
+}
+
+function statusClass(status) {
+  return status >= 200 && status < 400 ? "status-ok" : "status-error";
+}
+
+// --- List ---
+
+function filterParams() {
+  const params = new URLSearchParams();
+  for (const [key, value] of new FormData($("#filters"))) {
+    if (value) params.set(key, value);
+  }
+  return params;
+}
+
+async function showList() {
+  $("#list-view").hidden = false;
+  $("#detail-view").hidden = true;
+
+  const params = filterParams();
+  params.set("limit", pageSize);
+  params.set("offset", offset);
+
+  let page;
+  try {
+    page = await api(`api/recordings?${params}`);
+    showMessage("");
+  } catch (err) {
+    showMessage(err.message);
+    return;
+  }
+
+  const rows = page.recordings.map((rec) => {
+    const badges = [];
+    if (rec.streaming) badges.push(el("span", "badge", "stream"));
+    if (rec.outcome && rec.outcome !== "completed") badges.push(el("span", "badge", rec.outcome));
+    if (rec.cache_hit) badges.push(el("span", "badge", "cache"));
+
+    const row = el("tr", null, [
+      el("td", null, new Date(rec.timestamp).toLocaleString()),
+      el("td", "mono", rec.id.slice(0, 8)),
+      el("td", null, rec.provider),
+      el("td", null, rec.model || ""),
+      el("td", "path mono", [`${rec.method} ${rec.path}`, ...badges]),
+      el("td", statusClass(rec.status), String(rec.status || "")),
+      el("td", "num", formatDuration(rec.duration_ms)),
+      el("td", "num", rec.usage ? String(rec.usage.total_tokens) : ""),
+    ]);
+    row.addEventListener("click", () => { location.hash = `#/recordings/${rec.id}`; });
+    return row;
+  });
+  $("#recordings tbody").replaceChildren(...rows);
+
+  if (page.total === 0) {
+    $("#page-info").textContent = "No recordings";
+  } else {
+    // An inexact total only counts the days read so far
+    const total = page.total_exact ? String(page.total) : `${page.total}+`;
+    $("#page-info").textContent = `${offset + 1}–${offset + page.recordings.length} of ${total}`;
+  }
+  $('[data-page="prev"]').disabled = offset === 0;
+  $('[data-page="next"]').disabled = offset + page.recordings.length >= page.total;
+}
+
+// --- Detail ---
+
+async function showRecording(id) {
+  $("#list-view").hidden = true;
+  $("#detail-view").hidden = false;
+
+  let rec, transcript;
+  try {
+    const path = `api/recordings/${encodeURIComponent(id)}`;
+    [rec, transcript] = await Promise.all([api(path), api(`${path}/transcript`)]);
+    showMessage("");
+  } catch (err) {
+    showMessage(err.message);
+    return;
+  }
+
+  renderSummary(rec);
+  renderTranscript(rec, transcript);
+  renderTiming(rec);
+  renderHeaders(rec);
+  $("#tab-raw pre").textContent = JSON.stringify(rec, null, 2);
+}
+
+function renderSummary(rec) {
+  const fields = [
+    ["ID", rec.id],
+    ["Time", new Date(rec.timestamp).toLocaleString()],
+    ["Provider", rec.provider],
+    ["Model", rec.model],
+    ["Client", rec.client],
+    ["Request", `${rec.request.method} ${rec.request.path}${rec.request.query ? "?" + rec.request.query : ""}`],
+    ["Status", rec.response.status ? String(rec.response.status) : ""],
+    ["Outcome", rec.response.outcome],
+    ["Error", rec.response.error],
+    ["Duration", formatDuration(rec.timing.duration_ms)],
+    ["Tokens", rec.usage ? `${rec.usage.input_tokens} in, ${rec.usage.output_tokens} out` : ""],
+  ];
+  const list = el("dl");
+  for (const [name, value] of fields) {
+    if (!value) continue;
+    list.append(el("dt", null, name), el("dd", name === "Status" ? statusClass(rec.response.status) : null, value));
+  }
+  $("#detail-summary").replaceChildren(list);
+}
+
+function renderBlock(block) {
+  switch (block.kind) {
+    case "tool_call":
+      return el("div", "block", [
+        el("span", "label", `Tool call: ${block.name}${block.id ? ` (${block.id})` : ""}`),
+        el("pre", null, typeof block.input === "string" ? block.input : JSON.stringify(block.input ?? {}, null, 2)),
+      ]);
+    case "tool_result":
+      return el("div", "block", [
+        el("span", "label", `Tool result${block.name ? `: ${block.name}` : ""}${block.id ? ` (${block.id})` : ""}${block.error ? " — error" : ""}`),
+        el("pre", null, block.text),
+      ]);
+    case "thinking":
+      return el("div", "block thinking", [el("span", "label", "Thinking"), block.text]);
+    case "placeholder":
+      return el("div", "block placeholder", block.text);
+    default:
+      return el("div", "block", block.text);
+  }
+}
+
+function renderTurn(turn, className) {
+  return el("div", `turn ${turn.role} ${className || ""}`, [
+    el("div", "role", turn.role),
+    ...(turn.blocks || []).map(renderBlock),
+  ]);
+}
+
+// renderTranscript shows the turns the admin API built from the recording,
+// so the providers' formats are only known to the Go code
+function renderTranscript(rec, transcript) {
+  const container = $("#tab-transcript");
+  const nodes = transcript.request.map((turn) => renderTurn(turn));
+  nodes.push(...transcript.completion.map((turn) => renderTurn(turn, "completion")));
+
+  if (rec.response.status >= 400 && rec.response.body) {
+    nodes.push(el("div", "turn error", [
+      el("div", "role", `Error ${rec.response.status}`),
+      el("pre", "block", typeof rec.response.body === "string" ? rec.response.body : JSON.stringify(rec.response.body, null, 2)),
+    ]));
+  }
+  if (rec.response.frames) {
+    nodes.push(el("p", null, `${rec.response.frames.length} WebSocket frame(s); see Raw.`));
+  }
+  if (nodes.length === 0) {
+    nodes.push(el("p", null, "No conversation in this recording; see Raw."));
+  }
+  container.replaceChildren(...nodes);
+}
+
+// renderTiming draws the request as a waterfall: proxy overhead, connection
+// setup, waiting for the first byte and then the response transfer, which
+// takes the rest of the total duration
+function renderTiming(rec) {
+  const timing = rec.timing;
+  const upstream = timing.upstream || {};
+  const total = Math.max(timing.duration_ms, 1);
+
+  const phases = [
+    ["Proxy overhead", (upstream.overhead_us || 0) / 1000, "setup"],
+    ["DNS lookup", upstream.dns_ms || 0, "setup"],
+    ["Connect", upstream.connect_ms || 0, "setup"],
+    ["TLS handshake", upstream.tls_ms || 0, "setup"],
+    ["Waiting (TTFB)", upstream.ttfb_ms || 0, "wait"],
+  ];
+  const used = phases.reduce((sum, [, ms]) => sum + ms, 0);
+  phases.push(["Response transfer", Math.max(timing.duration_ms - used, 0), ""]);
+
+  const rows = [];
+  let start = 0;
+  for (const [name, ms, className] of phases) {
+    const bar = el("div", `bar ${className}`);
+    bar.style.left = `${Math.min(start / total, 1) * 100}%`;
+    bar.style.width = `${Math.min(ms / total, 1) * 100}%`;
+    rows.push(el("div", "row", [
+      el("span", null, name),
+      el("div", "track", [bar]),
+      el("span", "value", ms < 1 && ms > 0 ? `${ms.toFixed(2)}ms` : `${Math.round(ms)}ms`),
+    ]));
+    start += ms;
+  }
+
+  const notes = [];
+  if (rec.timing.upstream) {
+    notes.push(upstream.protocol || "", upstream.conn_reused ? "reused connection" : "new connection");
+  } else {
+    notes.push("No upstream timing in this recording.");
+  }
+  $("#tab-timing").replaceChildren(
+    el("div", "waterfall", rows),
+    el("p", null, `Total ${formatDuration(timing.duration_ms)}. ${notes.filter(Boolean).join(", ")}`),
+  );
+}
+
+function headerTable(title, headers) {
+  if (!headers || Object.keys(headers).length === 0) return null;
+  const rows = Object.keys(headers).sort().map((name) =>
+    el("tr", null, [el("td", "mono", name), el("td", "mono", headers[name].join(", "))]));
+  return el("div", null, [el("h3", null, title), el("table", null, [el("tbody", null, rows)])]);
+}
+
+function renderHeaders(rec) {
+  $("#tab-headers").replaceChildren(el("div", "headers", [
+    headerTable("Request headers", rec.request.headers),
+    rec.forwarded_request ? headerTable("Forwarded request headers", rec.forwarded_request.headers) : null,
+    headerTable("Response headers", rec.response.headers),
+    el("p", null, "Credentials are redacted."),
+  ]));
+}
+
+function showTab(name) {
+  for (const button of document.querySelectorAll("#tabs button")) {
+    button.classList.toggle("active", button.dataset.tab === name);
+  }
+  for (const tab of document.querySelectorAll(".tab")) {
+    tab.hidden = tab.id !== `tab-${name}`;
+  }
+}
+
+// --- Routing ---
+
+function route() {
+  const match = location.hash.match(/^#\/recordings\/(.+)$/);
+  if (match) showRecording(decodeURIComponent(match[1]));
+  else showList();
+}
+
+$("#filters").addEventListener("submit", (event) => {
+  event.preventDefault();
+  offset = 0;
+  if (location.hash.startsWith("#/recordings/")) location.hash = "#/";
+  else showList();
+});
+
+$("#pager").addEventListener("click", (event) => {
+  const page = event.target.dataset.page;
+  if (!page) return;
+  offset = page === "next" ? offset + pageSize : Math.max(offset - pageSize, 0);
+  showList();
+});
+
+$("#tabs").addEventListener("click", (event) => {
+  if (event.target.dataset.tab) showTab(event.target.dataset.tab);
+});
+
+$("#token-button").addEventListener("click", () => {
+  if (askForToken()) route();
+});
+
+window.addEventListener("hashchange", route);
+route();
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/llmite-ai/mirra/internal/config"
+)
+
+// HeaderName is the header clients use to authenticate with the proxy. It is
+// consumed by MIRRA and never forwarded upstream, so it does not collide with
+// the Authorization header carrying the provider API key.
+const HeaderName = "Proxy-Authorization"
+
+type contextKey struct{}
+
+// Authenticator resolves proxy credentials to a client name.
+type Authenticator struct {
+	enabled bool
+	clients []config.ClientConfig
+}
+
+func New(cfg config.AuthConfig) *Authenticator {
+	return &Authenticator{
+		enabled: cfg.Enabled,
+		clients: cfg.Clients,
+	}
+}
+
+// Enabled reports whether proxy traffic requires authentication
+func (a *Authenticator) Enabled() bool {
+	return a.enabled
+}
+
+// Authenticate checks the request credentials and returns the matching
+// client name. A verified TLS client certificate also identifies a client by
+// its common name. When authentication is disabled every request is
+// accepted, named after its client certificate if it presented one.
+func (a *Authenticator) Authenticate(r *http.Request) (string, bool) {
+	header := r.Header.Get(HeaderName)
+	if !a.enabled || header == "" {
+		if name := certificateName(r); name != "" {
+			return name, true
+		}
+		return "", !a.enabled
+	}
+
+	scheme, credentials, ok := strings.Cut(header, " ")
+	if !ok {
+		return "", false
+	}
+	credentials = strings.TrimSpace(credentials)
+
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		return a.matchToken(credentials)
+	case "basic":
+		decoded, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return "", false
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return "", false
+		}
+		return a.matchBasic(username, password)
+	default:
+		return "", false
+	}
+}
+
+// matchToken compares the token against every configured client in constant
+// time so that response timing does not leak which prefix matched.
+func (a *Authenticator) matchToken(token string) (string, bool) {
+	var name string
+	for _, client := range a.clients {
+		if client.Token == "" {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(client.Token), []byte(token)) == 1 {
+			name = client.Name
+		}
+	}
+	return name, name != ""
+}
+
+func (a *Authenticator) matchBasic(username, password string) (string, bool) {
+	var name string
+	for _, client := range a.clients {
+		if client.Username == "" {
+			continue
+		}
+		userMatch := subtle.ConstantTimeCompare([]byte(client.Username), []byte(username))
+		passMatch := subtle.ConstantTimeCompare([]byte(client.Password), []byte(password))
+		if userMatch&passMatch == 1 {
+			name = client.Name
+		}
+	}
+	return name, name != ""
+}
+
+// certificateName returns the common name of a verified client certificate
+func certificateName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
+
+// Middleware rejects unauthenticated requests with 407 Proxy Authentication
+// Required and stores the client name in the request context.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, ok := a.Authenticate(r)
+		if !ok {
+			slog.Warn("proxy authentication failed",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"remote_addr", r.RemoteAddr)
+			w.Header().Set("Proxy-Authenticate", `Basic realm="mirra"`)
+			http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+			return
+		}
+
+		if client != "" {
+			r = r.WithContext(WithClient(r.Context(), client))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithClient returns a copy of ctx carrying the client name
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, contextKey{}, client)
+}
+
+// ClientFromContext returns the authenticated client name, or "" if the
+// request was not authenticated.
+func ClientFromContext(ctx context.Context) string {
+	client, _ := ctx.Value(contextKey{}).(string)
+	return client
+}
@@ -0,0 +1,192 @@
+// Package capture keeps a copy of a relayed body for the recording while
+// bounding the memory it takes. Bodies up to a limit are held in memory;
+// larger ones either spill to a temporary file or are truncated.
+package capture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Buffer is an io.Writer that never fails, so it can sit beside a client
+// connection or upstream request without interrupting the relay. It is safe
+// for concurrent use: the HTTP transport may still be reading a request body
+// after the response has arrived.
+type Buffer struct {
+	limit    int64
+	spillDir string
+
+	mu       sync.Mutex
+	finished bool
+
+	mem       bytes.Buffer
+	file      *os.File
+	spillPath string
+	hash      hash.Hash
+	size      int64
+	spilled   bool
+	truncated bool
+}
+
+// New returns a Buffer that holds up to limit bytes in memory (0 means no
+// limit). Beyond that, the body spills to a temporary file in spillDir, or is
+// truncated if spillDir is empty.
+func New(limit int64, spillDir string) *Buffer {
+	return &Buffer{limit: limit, spillDir: spillDir}
+}
+
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	if b.finished {
+		return n, nil
+	}
+	b.size += int64(n)
+
+	switch {
+	case b.file != nil:
+		b.writeFile(p)
+	case b.truncated:
+	case b.limit == 0 || int64(b.mem.Len()+n) <= b.limit:
+		b.mem.Write(p)
+	case b.spillDir != "" && b.spill():
+		b.writeFile(p)
+	default:
+		b.mem.Write(p[:b.limit-int64(b.mem.Len())])
+		b.truncated = true
+	}
+
+	return n, nil
+}
+
+// spill moves the in-memory bytes to a temporary file
+func (b *Buffer) spill() bool {
+	if err := os.MkdirAll(b.spillDir, 0755); err != nil {
+		slog.Error("failed to create spill directory", "error", err, "path", b.spillDir)
+		return false
+	}
+	f, err := os.CreateTemp(b.spillDir, "body-*")
+	if err != nil {
+		slog.Error("failed to create spill file", "error", err)
+		return false
+	}
+
+	b.file = f
+	b.spilled = true
+	b.hash = sha256.New()
+	b.writeFile(b.mem.Bytes())
+	if !b.spilled {
+		return false
+	}
+	b.mem = bytes.Buffer{}
+	return true
+}
+
+func (b *Buffer) writeFile(p []byte) {
+	if _, err := b.file.Write(p); err != nil {
+		slog.Error("failed to write spill file, dropping captured body", "error", err)
+		b.discard()
+		b.spilled = false
+		b.truncated = true
+		return
+	}
+	b.hash.Write(p)
+}
+
+// Bytes returns the body held in memory: all of it unless it spilled or was
+// truncated, in which case see Spilled and Truncated
+func (b *Buffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.mem.Bytes()
+}
+
+// Size returns the total number of bytes written, including any not kept
+func (b *Buffer) Size() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// Complete reports whether Bytes holds the entire body
+func (b *Buffer) Complete() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.spilled && !b.truncated
+}
+
+// Spilled reports whether the body was written to a temporary file
+func (b *Buffer) Spilled() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.spilled
+}
+
+// Truncated reports whether part of the body was dropped
+func (b *Buffer) Truncated() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.truncated
+}
+
+// Close stops capturing; later writes are ignored. A spill file is closed
+// but left on disk, see SpillFile.
+func (b *Buffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.finished = true
+	if b.file == nil {
+		return nil
+	}
+
+	b.spillPath = b.file.Name()
+	if err := b.file.Close(); err != nil {
+		b.file = nil
+		b.discard()
+		b.spilled = false
+		b.truncated = true
+		return err
+	}
+	b.file = nil
+	return nil
+}
+
+// SpillFile returns the path and SHA-256 digest of the spill file after Close
+func (b *Buffer) SpillFile() (string, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.spillPath == "" {
+		return "", ""
+	}
+	return b.spillPath, hex.EncodeToString(b.hash.Sum(nil))
+}
+
+// Discard stops capturing and removes the spill file, if it is still there
+func (b *Buffer) Discard() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.finished = true
+	b.discard()
+}
+
+func (b *Buffer) discard() {
+	if b.file != nil {
+		b.spillPath = b.file.Name()
+		b.file.Close()
+		b.file = nil
+	}
+	if b.spillPath != "" {
+		os.Remove(b.spillPath)
+		b.spillPath = ""
+	}
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/llmite-ai/mirra/internal/ca"
+	"github.com/llmite-ai/mirra/internal/config"
+)
+
+func CA(args []string) error {
+	fs := flag.NewFlagSet("ca", flag.ExitOnError)
+	dir := fs.String("dir", "", "Directory holding the CA certificate and key (default: forward_proxy.ca_dir)")
+	configPath := fs.String("config", "", "Path to config file, for the CA directory and the intercepted hosts")
+	export := fs.String("export", "", "Write the CA certificate (PEM) to this file, or - for stdout")
+	regenerate := fs.Bool("regenerate", false, "Replace the existing CA with a new one")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if *dir == "" {
+		*dir = cfg.Forward.CADir
+	}
+	// A new CA may only sign for the hosts MIRRA intercepts
+	hosts := slices.Sorted(maps.Keys(cfg.Forward.InterceptHosts()))
+
+	var authority *ca.CA
+
+	if *regenerate {
+		authority, err = ca.Generate(*dir, hosts)
+		if err != nil {
+			return fmt.Errorf("failed to generate CA: %w", err)
+		}
+		slog.Info("generated new CA", "dir", *dir, "hosts", hosts)
+	} else {
+		var created bool
+		authority, created, err = ca.LoadOrGenerate(*dir, hosts)
+		if err != nil {
+			return fmt.Errorf("failed to load CA: %w", err)
+		}
+		if created {
+			slog.Info("generated new CA", "dir", *dir, "hosts", hosts)
+		} else if !authority.Constrained() {
+			slog.Warn("CA has no name constraints and can sign for any host, replace it with --regenerate", "dir", *dir)
+		}
+	}
+
+	switch *export {
+	case "":
+		certPath := filepath.Join(*dir, ca.CertFileName)
+		fmt.Printf("CA certificate: %s\n", certPath)
+		fmt.Println("\nTrust this certificate in your client, for example:")
+		fmt.Printf("  export SSL_CERT_FILE=%s          # Go, Ruby, OpenSSL-based tools\n", certPath)
+		fmt.Printf("  export REQUESTS_CA_BUNDLE=%s     # Python requests/httpx\n", certPath)
+		fmt.Printf("  export NODE_EXTRA_CA_CERTS=%s    # Node.js\n", certPath)
+		fmt.Println("\nThen route traffic through MIRRA:")
+		fmt.Println("  export HTTPS_PROXY=http://localhost:4567")
+	case "-":
+		os.Stdout.Write(authority.CertPEM())
+	default:
+		if err := os.WriteFile(*export, authority.CertPEM(), 0644); err != nil {
+			return fmt.Errorf("failed to export CA certificate: %w", err)
+		}
+		slog.Info("exported CA certificate", "output", *export)
+	}
+
+	return nil
+}
@@ -1,14 +1,10 @@
 package commands
 
 import (
-	"bufio"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/llmite-ai/mirra/internal/recorder"
@@ -21,40 +17,36 @@ func Export(args []string) error {
 	provider := fs.String("provider", "", "Filter by provider (claude|openai)")
 	output := fs.String("output", "export.jsonl", "Output file path")
 	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+	whereExpr := fs.String("where", "", `Filter expression, e.g. 'status>=400 and model~"claude-*"'`)
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
-	var fromDate, toDate time.Time
-	var err error
+	where, err := ParseFilters(*whereExpr, *provider, "", "")
+	if err != nil {
+		return err
+	}
+	filter := Filter{Where: where}
 
 	if *from != "" {
-		fromDate, err = time.Parse("2006-01-02", *from)
+		fromDate, err := time.Parse("2006-01-02", *from)
 		if err != nil {
 			return fmt.Errorf("invalid from date: %w", err)
 		}
+		filter.From = fromDate
 	}
 
 	if *to != "" {
-		toDate, err = time.Parse("2006-01-02", *to)
+		toDate, err := time.Parse("2006-01-02", *to)
 		if err != nil {
 			return fmt.Errorf("invalid to date: %w", err)
 		}
-		toDate = toDate.Add(24 * time.Hour) // Include the entire day
-	} else {
-		toDate = time.Now().Add(24 * time.Hour)
+		filter.To = toDate.Add(24 * time.Hour) // Include the entire day
 	}
 
-	// Find all recording files
-	pattern := filepath.Join(*recordingsPath, "recordings-*.jsonl")
-	files, err := filepath.Glob(pattern)
-	if err != nil {
-		return fmt.Errorf("failed to list recordings: %w", err)
-	}
-
-	if len(files) == 0 {
-		return fmt.Errorf("no recordings found in %s", *recordingsPath)
+	if _, err := RecordingFiles(*recordingsPath); err != nil {
+		return err
 	}
 
 	// Create output file
@@ -65,71 +57,23 @@ func Export(args []string) error {
 	defer outFile.Close()
 
 	count := 0
-
-	// Process each recording file
-	for _, file := range files {
-		// Extract date from filename
-		base := filepath.Base(file)
-		datePart := strings.TrimPrefix(base, "recordings-")
-		datePart = strings.TrimSuffix(datePart, ".jsonl")
-
-		fileDate, err := time.Parse("2006-01-02", datePart)
-		if err != nil {
-			continue
-		}
-
-		// Check if file is within date range
-		if *from != "" && fileDate.Before(fromDate) {
-			continue
-		}
-		if fileDate.After(toDate) {
-			continue
+	var writeErr error
+	err = ScanRecordings(*recordingsPath, filter, func(_ *recorder.Recording, raw []byte) bool {
+		// Write to output; raw belongs to the scanner, so it isn't appended to
+		if _, writeErr = outFile.Write(raw); writeErr != nil {
+			return false
 		}
-
-		// Read and filter recordings
-		f, err := os.Open(file)
-		if err != nil {
-			continue
+		if _, writeErr = outFile.Write([]byte("\n")); writeErr != nil {
+			return false
 		}
-
-		scanner := bufio.NewScanner(f)
-		// Increase buffer size to handle large recordings (default is 64KB)
-		const maxScanTokenSize = 10 * 1024 * 1024 // 10MB
-		buf := make([]byte, maxScanTokenSize)
-		scanner.Buffer(buf, maxScanTokenSize)
-
-		for scanner.Scan() {
-			var rec recorder.Recording
-			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
-				continue
-			}
-
-			// Apply filters
-			if *provider != "" && rec.Provider != *provider {
-				continue
-			}
-
-			if *from != "" && rec.Timestamp.Before(fromDate) {
-				continue
-			}
-			if rec.Timestamp.After(toDate) {
-				continue
-			}
-
-			// Write to output
-			if _, err := outFile.Write(scanner.Bytes()); err != nil {
-				f.Close()
-				return fmt.Errorf("failed to write to output: %w", err)
-			}
-			if _, err := outFile.Write([]byte("\n")); err != nil {
-				f.Close()
-				return fmt.Errorf("failed to write newline: %w", err)
-			}
-
-			count++
-		}
-
-		f.Close()
+		count++
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return fmt.Errorf("failed to write to output: %w", writeErr)
 	}
 
 	slog.Info("export complete", "count", count, "output", *output)
@@ -0,0 +1,339 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/llmite-ai/mirra/internal/llm"
+	"github.com/llmite-ai/mirra/internal/query"
+	"github.com/llmite-ai/mirra/internal/recorder"
+)
+
+// Filter selects recordings. Zero fields match everything.
+type Filter struct {
+	From time.Time // inclusive
+	To   time.Time // exclusive
+	// Query matches recordings whose JSON contains it, ignoring case
+	Query string
+	// Where is a filter expression, from --where and the flags that are
+	// shorthands for it
+	Where *query.Query
+}
+
+// Match reports whether a recording passes the filter. raw is the
+// recording's JSON line, used for Query.
+func (f Filter) Match(rec *recorder.Recording, raw []byte) bool {
+	if !f.From.IsZero() && rec.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !rec.Timestamp.Before(f.To) {
+		return false
+	}
+	if f.Query != "" && !bytes.Contains(bytes.ToLower(raw), []byte(strings.ToLower(f.Query))) {
+		return false
+	}
+	return f.Where.Match(rec)
+}
+
+// ParseWhere compiles a --where filter expression. An empty expression
+// matches everything.
+func ParseWhere(expr string) (*query.Query, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	return query.Parse(expr)
+}
+
+// ParseFilters compiles a --where expression together with the --provider,
+// --model and --status flags, which are shorthands for provider=, model=
+// and status= comparisons and'ed with it. status is a code such as 429 or a
+// class such as 5xx.
+func ParseFilters(where, provider, model, status string) (*query.Query, error) {
+	// Parse the expression alone first, so errors point into it
+	q, err := ParseWhere(where)
+	if err != nil {
+		return nil, err
+	}
+
+	var terms []string
+	if provider != "" {
+		terms = append(terms, "provider="+strconv.Quote(provider))
+	}
+	if model != "" {
+		terms = append(terms, "model="+strconv.Quote(model))
+	}
+	if status != "" {
+		if !statusPattern.MatchString(status) {
+			return nil, fmt.Errorf("invalid status %q: use a code such as 429 or a class such as 5xx", status)
+		}
+		terms = append(terms, "status="+status)
+	}
+	if len(terms) == 0 {
+		return q, nil
+	}
+	if q != nil {
+		terms = append(terms, "("+where+")")
+	}
+	return query.Parse(strings.Join(terms, " and "))
+}
+
+var statusPattern = regexp.MustCompile(`^([1-5][0-9][0-9]|[1-5][xX][xX])$`)
+
+// ParseDate parses a YYYY-MM-DD date or an RFC 3339 timestamp
+func ParseDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// ErrNoRecordings is returned when a directory holds no recording files
+var ErrNoRecordings = errors.New("no recordings found")
+
+// RecordingFiles lists the recording files in dir, oldest first
+func RecordingFiles(dir string) ([]string, error) {
+	pattern := filepath.Join(dir, "recordings-*.jsonl")
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNoRecordings, dir)
+	}
+	return files, nil
+}
+
+// ScanRecordings calls fn with every recording in dir that passes filter,
+// along with its JSON line, until fn returns false. Daily files entirely
+// outside the filter's date range are skipped without being read.
+func ScanRecordings(dir string, filter Filter, fn func(rec *recorder.Recording, raw []byte) bool) error {
+	files, err := RecordingFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		more, err := ScanFile(file, filter, fn)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScanFile is ScanRecordings for one daily file, for callers that read the
+// files in another order. It returns false if fn stopped the scan.
+func ScanFile(file string, filter Filter, fn func(rec *recorder.Recording, raw []byte) bool) (bool, error) {
+	// Extract date from filename
+	base := filepath.Base(file)
+	datePart := strings.TrimPrefix(base, "recordings-")
+	datePart = strings.TrimSuffix(datePart, ".jsonl")
+
+	fileDate, err := time.Parse("2006-01-02", datePart)
+	if err != nil {
+		return true, nil
+	}
+	if !filter.From.IsZero() && fileDate.Add(24*time.Hour).Before(filter.From) {
+		return true, nil
+	}
+	if !filter.To.IsZero() && fileDate.After(filter.To) {
+		return true, nil
+	}
+
+	return scanFile(file, filter, fn)
+}
+
+// scanFile scans one recording file, returning false if fn stopped the scan.
+// Lines are read whole, however large: a recording's size is bounded only by
+// the body limits it was recorded with.
+func scanFile(file string, filter Filter, fn func(rec *recorder.Recording, raw []byte) bool) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return true, nil
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if line = bytes.TrimRight(line, "\r\n"); len(line) > 0 && !scanLine(line, filter, fn) {
+			return false, nil
+		}
+		if readErr == io.EOF {
+			return true, nil
+		}
+		if readErr != nil {
+			return false, fmt.Errorf("failed to read %s: %w", file, readErr)
+		}
+	}
+}
+
+// scanLine decodes and filters one recording line, returning false if fn
+// stopped the scan
+func scanLine(line []byte, filter Filter, fn func(rec *recorder.Recording, raw []byte) bool) bool {
+	var rec recorder.Recording
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return true
+	}
+	// Reassemble before matching, so queries see the final response
+	reassembled := reassemble(&rec)
+	if !filter.Match(&rec, line) {
+		return true
+	}
+	raw := line
+	if reassembled {
+		// Keep the line in step for callers that copy it, like export
+		if data, err := json.Marshal(&rec); err == nil {
+			raw = data
+		}
+	}
+	return fn(&rec, raw)
+}
+
+// reassemble stores the reassembled response of a stream recorded before
+// MIRRA kept one, reporting whether it did
+func reassemble(rec *recorder.Recording) bool {
+	if rec.Response.Reassembled != nil {
+		return false
+	}
+	final := llm.Reassemble(rec.Provider, rec.Response.Body, rec.Response.Streaming)
+	if final == nil {
+		return false
+	}
+	rec.Response.Reassembled = final
+	return true
+}
+
+// FinalResponse returns the response a client would have received without
+// streaming: the reassembled stream, or the body as recorded
+func FinalResponse(rec *recorder.Recording) any {
+	if rec.Response.Reassembled != nil {
+		return rec.Response.Reassembled
+	}
+	return rec.Response.Body
+}
+
+// Summary is the listing form of a recording, without headers and bodies
+type Summary struct {
+	ID          string          `json:"id"`
+	Timestamp   time.Time       `json:"timestamp"`
+	Provider    string          `json:"provider"`
+	Client      string          `json:"client,omitempty"`
+	Model       string          `json:"model,omitempty"`
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	Status      int             `json:"status"`
+	Streaming   bool            `json:"streaming"`
+	DurationMs  int64           `json:"duration_ms"`
+	Usage       *recorder.Usage `json:"usage,omitempty"`
+	Outcome     string          `json:"outcome,omitempty"`
+	RateLimited bool            `json:"rate_limited,omitempty"`
+	CacheHit    bool            `json:"cache_hit,omitempty"`
+}
+
+// Summarize returns the summary of a recording
+func Summarize(rec *recorder.Recording) Summary {
+	return Summary{
+		ID:          rec.ID,
+		Timestamp:   rec.Timestamp,
+		Provider:    rec.Provider,
+		Client:      rec.Client,
+		Model:       rec.Model,
+		Method:      rec.Request.Method,
+		Path:        rec.Request.Path,
+		Status:      rec.Response.Status,
+		Streaming:   rec.Response.Streaming,
+		DurationMs:  rec.Timing.DurationMs,
+		Usage:       rec.Usage,
+		Outcome:     rec.Outcome,
+		RateLimited: rec.RateLimited,
+		CacheHit:    rec.CacheHit,
+	}
+}
+
+// AmbiguousIDError is returned by FindRecording when an ID prefix matches
+// more than one recording
+type AmbiguousIDError struct {
+	ID      string
+	Matches []string
+}
+
+func (e *AmbiguousIDError) Error() string {
+	return fmt.Sprintf("ambiguous recording ID '%s' matches %d recordings", e.ID, len(e.Matches))
+}
+
+// ErrNotFound is returned by FindRecording when no recording matches
+var ErrNotFound = errors.New("recording not found")
+
+// FindRecording returns the recording passing filter with the given ID or
+// unique ID prefix
+func FindRecording(dir, id string, filter Filter) (*recorder.Recording, error) {
+	var matches []recorder.Recording
+	err := ScanRecordings(dir, filter, func(rec *recorder.Recording, _ []byte) bool {
+		// Support both exact match and prefix match
+		if strings.HasPrefix(rec.ID, id) {
+			matches = append(matches, *rec)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	case 1:
+		return &matches[0], nil
+	}
+
+	ambiguous := &AmbiguousIDError{ID: id}
+	for _, m := range matches {
+		ambiguous.Matches = append(ambiguous.Matches, m.ID)
+	}
+	return nil, ambiguous
+}
+
+// LastRecording returns the most recent recording in dir passing filter
+func LastRecording(dir string, filter Filter) (*recorder.Recording, error) {
+	var last *recorder.Recording
+	err := ScanRecordings(dir, filter, func(rec *recorder.Recording, _ []byte) bool {
+		if last == nil || rec.Timestamp.After(last.Timestamp) {
+			last = rec
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return nil, fmt.Errorf("no valid recordings found")
+	}
+	return last, nil
+}
+
+// CollectStats aggregates statistics over the recordings passing filter
+func CollectStats(dir string, filter Filter) (*Statistics, error) {
+	stats := &Statistics{
+		StopReasons: make(map[string]int64),
+		ByProvider:  make(map[string]*ProviderStats),
+	}
+	err := ScanRecordings(dir, filter, func(rec *recorder.Recording, _ []byte) bool {
+		stats.addRecording(rec)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,210 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/llmite-ai/mirra/internal/llm"
+	"github.com/llmite-ai/mirra/internal/recorder"
+)
+
+const (
+	// searchContext is how many bytes of text surround a match in a snippet
+	searchContext = 60
+	// maxSnippets is how many matching passages are shown per recording
+	maxSnippets = 3
+
+	highlightStart = "\033[1;93m"
+	highlightEnd   = "\033[0m"
+)
+
+// Search finds recordings whose message content matches a text or regular
+// expression. Only conversation text is searched (messages, tool calls and
+// results, and the completion, reassembled for streams), never headers or
+// binary content.
+func Search(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	in := fs.String("in", "both", "Where to search: request, response or both")
+	useRegex := fs.Bool("regex", false, "Treat the search text as a regular expression")
+	caseSensitive := fs.Bool("case-sensitive", false, "Match case")
+	whereExpr := fs.String("where", "", `Only search recordings matching a filter expression, e.g. 'provider=claude'`)
+	limit := fs.Int("limit", 0, "Stop after this many matching recordings (0 for no limit)")
+	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: mirra search [flags] \"text\"")
+	}
+
+	var searchRequest, searchResponse bool
+	switch *in {
+	case "request":
+		searchRequest = true
+	case "response":
+		searchResponse = true
+	case "both":
+		searchRequest, searchResponse = true, true
+	default:
+		return fmt.Errorf("invalid --in %q: must be request, response or both", *in)
+	}
+
+	expr := fs.Arg(0)
+	if !*useRegex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if !*caseSensitive {
+		expr = "(?i)" + expr
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid regular expression: %w", err)
+	}
+
+	where, err := ParseWhere(*whereExpr)
+	if err != nil {
+		return err
+	}
+
+	highlight := isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+	matched := 0
+	err = ScanRecordings(*recordingsPath, Filter{Where: where}, func(rec *recorder.Recording, _ []byte) bool {
+		var passages []passage
+		if searchRequest {
+			passages = append(passages, turnPassages(llm.RequestTurns(rec.Provider, rec.Request.Body), "")...)
+		}
+		if searchResponse && rec.Response.Status < 400 {
+			passages = append(passages, turnPassages(llm.ResponseTurns(rec.Provider, FinalResponse(rec)), "completion")...)
+		}
+
+		var hits []string
+		for _, p := range passages {
+			for _, loc := range pattern.FindAllStringIndex(p.text, -1) {
+				if loc[0] == loc[1] {
+					continue // empty matches say nothing
+				}
+				hits = append(hits, p.label+": "+matchSnippet(p.text, loc, pattern, highlight))
+				break // one snippet per passage
+			}
+		}
+		if len(hits) == 0 {
+			return true
+		}
+
+		matched++
+		printSearchResult(rec, hits)
+		return *limit == 0 || matched < *limit
+	})
+	if err != nil {
+		return err
+	}
+
+	if matched == 0 {
+		fmt.Println("No matching recordings")
+	} else {
+		fmt.Printf("\n%d matching recording(s)\n", matched)
+	}
+	return nil
+}
+
+// passage is searchable text from one part of a conversation
+type passage struct {
+	label string // the turn's role, or the kind of block
+	text  string
+}
+
+// turnPassages collects the text of turns, labelled with the turn's role
+// (or with role when set) and, for tool calls and results, the tool.
+// Placeholders for images and files are skipped. Whitespace is collapsed so
+// phrases match across line breaks.
+func turnPassages(turns []llm.Turn, role string) []passage {
+	var passages []passage
+	for _, turn := range turns {
+		label := role
+		if label == "" {
+			label = turn.Role
+		}
+		for _, block := range turn.Blocks {
+			text := block.Text
+			blockLabel := label
+			switch block.Kind {
+			case llm.BlockPlaceholder:
+				continue
+			case llm.BlockThinking:
+				blockLabel += " thinking"
+			case llm.BlockToolCall:
+				blockLabel += " tool call " + block.Name
+				if s, ok := block.Input.(string); ok {
+					text = s
+				} else if data, err := json.Marshal(block.Input); err == nil {
+					text = string(data)
+				}
+			case llm.BlockToolResult:
+				blockLabel += " tool result"
+				if block.Name != "" {
+					blockLabel += " " + block.Name
+				}
+			}
+			if text = strings.Join(strings.Fields(text), " "); text != "" {
+				passages = append(passages, passage{label: blockLabel, text: text})
+			}
+		}
+	}
+	return passages
+}
+
+// matchSnippet returns the text around a match, highlighting every match
+// within it when highlight is set
+func matchSnippet(text string, loc []int, pattern *regexp.Regexp, highlight bool) string {
+	start := max(loc[0]-searchContext, 0)
+	end := min(loc[1]+searchContext, len(text))
+	// Don't cut multi-byte characters
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	snippet := text[start:end]
+	if highlight {
+		snippet = pattern.ReplaceAllStringFunc(snippet, func(m string) string {
+			return highlightStart + m + highlightEnd
+		})
+	}
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(text) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+func printSearchResult(rec *recorder.Recording, hits []string) {
+	line := fmt.Sprintf("\n%s  %s  %s", rec.ID, rec.Timestamp.Format("2006-01-02 15:04:05"), rec.Provider)
+	if rec.Model != "" {
+		line += " " + rec.Model
+	}
+	fmt.Printf("%s  %d\n", line, rec.Response.Status)
+
+	for i, hit := range hits {
+		if i == maxSnippets {
+			fmt.Printf("  (%d more)\n", len(hits)-maxSnippets)
+			break
+		}
+		fmt.Printf("  %s\n", hit)
+	}
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -1,15 +1,13 @@
 package commands
 
 import (
-	"bufio"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/llmite-ai/mirra/internal/llm"
 	"github.com/llmite-ai/mirra/internal/recorder"
 )
 
@@ -18,84 +16,28 @@ func Stats(args []string) error {
 	from := fs.String("from", "", "Start date (YYYY-MM-DD)")
 	provider := fs.String("provider", "", "Filter by provider (claude|openai)")
 	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+	whereExpr := fs.String("where", "", `Filter expression, e.g. 'status>=400 and model~"claude-*"'`)
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
-	var fromDate time.Time
-	var err error
-
+	where, err := ParseFilters(*whereExpr, *provider, "", "")
+	if err != nil {
+		return err
+	}
+	filter := Filter{Where: where}
 	if *from != "" {
-		fromDate, err = time.Parse("2006-01-02", *from)
+		fromDate, err := time.Parse("2006-01-02", *from)
 		if err != nil {
 			return fmt.Errorf("invalid from date: %w", err)
 		}
+		filter.From = fromDate
 	}
 
-	// Find all recording files
-	pattern := filepath.Join(*recordingsPath, "recordings-*.jsonl")
-	files, err := filepath.Glob(pattern)
+	stats, err := CollectStats(*recordingsPath, filter)
 	if err != nil {
-		return fmt.Errorf("failed to list recordings: %w", err)
-	}
-
-	if len(files) == 0 {
-		return fmt.Errorf("no recordings found in %s", *recordingsPath)
-	}
-
-	stats := &Statistics{
-		ByProvider: make(map[string]*ProviderStats),
-	}
-
-	// Process each recording file
-	for _, file := range files {
-		// Extract date from filename
-		base := filepath.Base(file)
-		datePart := strings.TrimPrefix(base, "recordings-")
-		datePart = strings.TrimSuffix(datePart, ".jsonl")
-
-		fileDate, err := time.Parse("2006-01-02", datePart)
-		if err != nil {
-			continue
-		}
-
-		// Check if file is after from date
-		if *from != "" && fileDate.Before(fromDate) {
-			continue
-		}
-
-		// Read and process recordings
-		f, err := os.Open(file)
-		if err != nil {
-			continue
-		}
-
-		scanner := bufio.NewScanner(f)
-		// Increase buffer size to handle large recordings (default is 64KB)
-		const maxScanTokenSize = 10 * 1024 * 1024 // 10MB
-		buf := make([]byte, maxScanTokenSize)
-		scanner.Buffer(buf, maxScanTokenSize)
-
-		for scanner.Scan() {
-			var rec recorder.Recording
-			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
-				continue
-			}
-
-			// Apply filters
-			if *provider != "" && rec.Provider != *provider {
-				continue
-			}
-
-			if *from != "" && rec.Timestamp.Before(fromDate) {
-				continue
-			}
-
-			stats.addRecording(&rec)
-		}
-
-		f.Close()
+		return err
 	}
 
 	stats.print()
@@ -103,25 +45,72 @@ func Stats(args []string) error {
 }
 
 type Statistics struct {
-	TotalRequests int64
-	TotalErrors   int64
-	TotalDuration int64
-	ByProvider    map[string]*ProviderStats
+	TotalRequests     int64 `json:"total_requests"`
+	TotalErrors       int64 `json:"total_errors"`
+	TotalCancelled    int64 `json:"total_cancelled"`
+	TotalRateLimited  int64 `json:"total_rate_limited"`
+	TotalCacheHits    int64 `json:"total_cache_hits"`
+	TotalDuration     int64 `json:"total_duration_ms"`
+	TotalInputTokens  int64 `json:"total_input_tokens"`
+	TotalOutputTokens int64 `json:"total_output_tokens"`
+	// Requests sent upstream with connection timing, how many of them
+	// reused a pooled connection, and the proxy overhead they added
+	UpstreamRequests int64 `json:"upstream_requests"`
+	ConnReused       int64 `json:"conn_reused"`
+	TotalOverheadUs  int64 `json:"total_overhead_us"`
+	// Tool calls and stop reasons are read from the final response, so
+	// streamed and non-streamed exchanges count alike
+	TotalToolCalls int64                     `json:"total_tool_calls"`
+	StopReasons    map[string]int64          `json:"stop_reasons"`
+	ByProvider     map[string]*ProviderStats `json:"by_provider"`
 }
 
 type ProviderStats struct {
-	Requests int64
-	Errors   int64
-	Duration int64
+	Requests     int64 `json:"requests"`
+	Errors       int64 `json:"errors"`
+	Cancelled    int64 `json:"cancelled"`
+	Duration     int64 `json:"duration_ms"`
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	ToolCalls    int64 `json:"tool_calls"`
 }
 
 func (s *Statistics) addRecording(rec *recorder.Recording) {
 	s.TotalRequests++
 	s.TotalDuration += rec.Timing.DurationMs
 
-	if rec.Response.Status >= 400 {
+	cancelled := rec.Outcome == recorder.OutcomeClientCancelled
+	failed := isFailure(rec)
+	if failed {
 		s.TotalErrors++
 	}
+	if cancelled {
+		s.TotalCancelled++
+	}
+	if rec.RateLimited {
+		s.TotalRateLimited++
+	}
+	if rec.CacheHit {
+		s.TotalCacheHits++
+	}
+	if upstream := rec.Timing.Upstream; upstream != nil {
+		s.UpstreamRequests++
+		s.TotalOverheadUs += upstream.OverheadUs
+		if upstream.ConnReused {
+			s.ConnReused++
+		}
+	}
+	// Cache hits are answered locally and consume no upstream tokens
+	if rec.Usage != nil && !rec.CacheHit {
+		s.TotalInputTokens += rec.Usage.InputTokens
+		s.TotalOutputTokens += rec.Usage.OutputTokens
+	}
+	final := FinalResponse(rec)
+	toolCalls := int64(llm.ToolCalls(rec.Provider, final))
+	s.TotalToolCalls += toolCalls
+	if reason := llm.StopReason(rec.Provider, final); reason != "" {
+		s.StopReasons[reason]++
+	}
 
 	if s.ByProvider[rec.Provider] == nil {
 		s.ByProvider[rec.Provider] = &ProviderStats{}
@@ -131,27 +120,72 @@ func (s *Statistics) addRecording(rec *recorder.Recording) {
 	provStats.Requests++
 	provStats.Duration += rec.Timing.DurationMs
 
-	if rec.Response.Status >= 400 {
+	if failed {
 		provStats.Errors++
 	}
+	if cancelled {
+		provStats.Cancelled++
+	}
+	if rec.Usage != nil && !rec.CacheHit {
+		provStats.InputTokens += rec.Usage.InputTokens
+		provStats.OutputTokens += rec.Usage.OutputTokens
+	}
+	provStats.ToolCalls += toolCalls
+}
+
+// isFailure reports whether an exchange failed: an error status or a
+// response the upstream broke off. Client cancellations are not failures.
+func isFailure(rec *recorder.Recording) bool {
+	switch rec.Outcome {
+	case recorder.OutcomeClientCancelled:
+		return false
+	case recorder.OutcomeUpstreamError, recorder.OutcomeTimeout:
+		return true
+	}
+	return rec.Response.Status >= 400
 }
 
 func (s *Statistics) print() {
 	fmt.Println("=== Overall Statistics ===")
 	fmt.Printf("Total Requests: %d\n", s.TotalRequests)
 	fmt.Printf("Total Errors: %d\n", s.TotalErrors)
+	fmt.Printf("Client Cancellations: %d\n", s.TotalCancelled)
+	fmt.Printf("Rate Limited: %d\n", s.TotalRateLimited)
+	fmt.Printf("Cache Hits: %d\n", s.TotalCacheHits)
 	if s.TotalRequests > 0 {
 		fmt.Printf("Error Rate: %.2f%%\n", float64(s.TotalErrors)/float64(s.TotalRequests)*100)
 		fmt.Printf("Average Response Time: %.2fms\n", float64(s.TotalDuration)/float64(s.TotalRequests))
 	}
+	if s.UpstreamRequests > 0 {
+		fmt.Printf("Upstream Connections Reused: %.2f%%\n", float64(s.ConnReused)/float64(s.UpstreamRequests)*100)
+		fmt.Printf("Average Proxy Overhead: %.0fµs\n", float64(s.TotalOverheadUs)/float64(s.UpstreamRequests))
+	}
+	fmt.Printf("Input Tokens: %d\n", s.TotalInputTokens)
+	fmt.Printf("Output Tokens: %d\n", s.TotalOutputTokens)
+	fmt.Printf("Tool Calls: %d\n", s.TotalToolCalls)
+	if len(s.StopReasons) > 0 {
+		reasons := make([]string, 0, len(s.StopReasons))
+		for reason := range s.StopReasons {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		fmt.Println("Stop Reasons:")
+		for _, reason := range reasons {
+			fmt.Printf("  %s: %d\n", reason, s.StopReasons[reason])
+		}
+	}
 
 	for provider, stats := range s.ByProvider {
 		fmt.Printf("\n=== %s ===\n", strings.ToUpper(provider))
 		fmt.Printf("Requests: %d\n", stats.Requests)
 		fmt.Printf("Errors: %d\n", stats.Errors)
+		fmt.Printf("Client Cancellations: %d\n", stats.Cancelled)
 		if stats.Requests > 0 {
 			fmt.Printf("Error Rate: %.2f%%\n", float64(stats.Errors)/float64(stats.Requests)*100)
 			fmt.Printf("Average Response Time: %.2fms\n", float64(stats.Duration)/float64(stats.Requests))
 		}
+		fmt.Printf("Input Tokens: %d\n", stats.InputTokens)
+		fmt.Printf("Output Tokens: %d\n", stats.OutputTokens)
+		fmt.Printf("Tool Calls: %d\n", stats.ToolCalls)
 	}
 }
@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/llmite-ai/mirra/internal/llm"
+	"github.com/llmite-ai/mirra/internal/recorder"
+	"github.com/llmite-ai/mirra/internal/sse"
+)
+
+// snippetLength is how many characters of the prompt and completion a tail
+// event carries
+const snippetLength = 160
+
+// TailEvent is a completed exchange as streamed by the admin API's tail
+// endpoint
+type TailEvent struct {
+	Summary
+	Prompt     string `json:"prompt,omitempty"`
+	Completion string `json:"completion,omitempty"`
+}
+
+// NewTailEvent summarizes a recording with snippets of its prompt and
+// completion
+func NewTailEvent(rec *recorder.Recording) TailEvent {
+	return TailEvent{
+		Summary:    Summarize(rec),
+		Prompt:     snippet(llm.Prompt(rec.Provider, rec.Request.Body)),
+		Completion: snippet(llm.Completion(rec.Provider, FinalResponse(rec), false)),
+	}
+}
+
+// snippet collapses whitespace and shortens text to snippetLength characters
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= snippetLength {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:snippetLength-1]) + "…"
+}
+
+func Tail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	adminAddr := fs.String("admin", "127.0.0.1:4568", "Admin API address (host:port, URL or unix:/path)")
+	token := fs.String("token", os.Getenv("MIRRA_ADMIN_TOKEN"), "Admin API token (default: $MIRRA_ADMIN_TOKEN)")
+	provider := fs.String("provider", "", "Filter by provider (claude|openai|gemini)")
+	model := fs.String("model", "", "Filter by model")
+	status := fs.String("status", "", "Filter by status code or class (e.g. 429, 4xx)")
+	whereExpr := fs.String("where", "", `Filter expression, e.g. 'status>=400 and model~"claude-*"'`)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Check the expression here for a clearer error than the API's
+	if _, err := ParseWhere(*whereExpr); err != nil {
+		return err
+	}
+
+	client, baseURL := adminClient(*adminAddr)
+	query := url.Values{}
+	for key, value := range map[string]string{"provider": *provider, "model": *model, "status": *status, "where": *whereExpr} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/api/tail?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("invalid admin address: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to admin API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("admin API returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	fmt.Fprintf(os.Stderr, "Tailing recordings from %s (Ctrl-C to stop)\n\n", baseURL)
+
+	parser := sse.Parser{OnEvent: func(event sse.Event) {
+		var e TailEvent
+		if err := json.Unmarshal([]byte(event.Data), &e); err != nil {
+			return
+		}
+		printTailEvent(&e)
+	}}
+	if _, err := io.Copy(&parser, resp.Body); err != nil {
+		return fmt.Errorf("lost connection to admin API: %w", err)
+	}
+	return fmt.Errorf("admin API closed the stream")
+}
+
+// adminClient returns a client and base URL for an admin API address,
+// dialing the socket for unix:/path addresses
+func adminClient(addr string) (*http.Client, string) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+		return &http.Client{Transport: transport}, "http://mirra-admin"
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return http.DefaultClient, strings.TrimSuffix(addr, "/")
+}
+
+func printTailEvent(e *TailEvent) {
+	line := fmt.Sprintf("[%s] %s %s", e.Timestamp.Format("15:04:05"), e.ID[:8], e.Provider)
+	if e.Model != "" {
+		line += " " + e.Model
+	}
+	line += fmt.Sprintf(" %d %dms", e.Status, e.DurationMs)
+	if e.Usage != nil {
+		line += fmt.Sprintf(" %d/%d tokens", e.Usage.InputTokens, e.Usage.OutputTokens)
+	}
+	if e.Outcome != "" && e.Outcome != recorder.OutcomeCompleted {
+		line += " " + e.Outcome
+	}
+	if e.CacheHit {
+		line += " (cached)"
+	}
+	if e.Client != "" {
+		line += " client=" + e.Client
+	}
+	fmt.Println(line)
+
+	if e.Prompt != "" {
+		fmt.Printf("  > %s\n", e.Prompt)
+	}
+	if e.Completion != "" {
+		fmt.Printf("  < %s\n", e.Completion)
+	}
+	if e.Prompt == "" && e.Completion == "" {
+		fmt.Printf("  %s %s\n", e.Method, e.Path)
+	}
+}
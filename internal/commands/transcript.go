@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/llmite-ai/mirra/internal/llm"
+	"github.com/llmite-ai/mirra/internal/recorder"
+)
+
+// Transcript is a recording as a conversation, shared by view --transcript
+// and the admin API
+type Transcript struct {
+	// Request is the system prompt and messages sent
+	Request []llm.Turn `json:"request"`
+	// Completion is read from the reassembled response for streams, and is
+	// empty for error responses
+	Completion []llm.Turn `json:"completion"`
+	StopReason string     `json:"stop_reason,omitempty"`
+}
+
+// NewTranscript builds the transcript of a recording
+func NewTranscript(rec *recorder.Recording) Transcript {
+	t := Transcript{
+		Request:    llm.RequestTurns(rec.Provider, rec.Request.Body),
+		Completion: []llm.Turn{},
+	}
+	if t.Request == nil {
+		t.Request = []llm.Turn{}
+	}
+	if rec.Response.Status >= 400 {
+		return t
+	}
+	final := FinalResponse(rec)
+	if completion := llm.ResponseTurns(rec.Provider, final); completion != nil {
+		t.Completion = completion
+	}
+	t.StopReason = llm.StopReason(rec.Provider, final)
+	return t
+}
+
+// printTranscript prints a recording as a conversation: the system prompt
+// and messages sent, then the completion
+func printTranscript(rec *recorder.Recording) {
+	fmt.Printf("=== Recording %s ===\n", rec.ID)
+	fmt.Printf("%s  %s %s", rec.Timestamp.Format(time.RFC3339), rec.Provider, rec.Model)
+	fmt.Printf("  %d  %dms", rec.Response.Status, rec.Timing.DurationMs)
+	if rec.Usage != nil {
+		fmt.Printf("  %d/%d tokens", rec.Usage.InputTokens, rec.Usage.OutputTokens)
+	}
+	fmt.Println()
+
+	t := NewTranscript(rec)
+	for _, turn := range t.Request {
+		printTurn(roleTitle(turn.Role), turn)
+	}
+
+	if rec.Response.Status >= 400 {
+		fmt.Printf("\n--- Error %d ---\n", rec.Response.Status)
+		printIndentedJSON(FinalResponse(rec))
+		return
+	}
+
+	title := "Completion"
+	if t.StopReason != "" {
+		title += " (" + t.StopReason + ")"
+	}
+	for _, turn := range t.Completion {
+		printTurn(title, turn)
+	}
+
+	if len(t.Request) == 0 && len(t.Completion) == 0 {
+		fmt.Println("\nNo conversation in this recording; run view without --transcript to see it.")
+	}
+	if rec.Outcome != "" && rec.Outcome != recorder.OutcomeCompleted {
+		fmt.Printf("\n[%s: %s]\n", rec.Outcome, rec.Error)
+	}
+}
+
+func printTurn(title string, turn llm.Turn) {
+	fmt.Printf("\n--- %s ---\n", title)
+	for i, block := range turn.Blocks {
+		if i > 0 {
+			fmt.Println()
+		}
+		switch block.Kind {
+		case llm.BlockThinking:
+			fmt.Println("[thinking]")
+			fmt.Println(indent(block.Text))
+		case llm.BlockToolCall:
+			fmt.Printf("[tool call] %s\n", toolLabel(block))
+			if s, ok := block.Input.(string); ok {
+				fmt.Println(indent(s))
+			} else {
+				printIndentedJSON(block.Input)
+			}
+		case llm.BlockToolResult:
+			label := toolLabel(block)
+			if block.Error {
+				label += " (error)"
+			}
+			fmt.Printf("[tool result] %s\n", label)
+			fmt.Println(indent(block.Text))
+		default:
+			fmt.Println(block.Text)
+		}
+	}
+}
+
+// roleTitle capitalizes a role for a section heading
+func roleTitle(role string) string {
+	if role == "" {
+		return "Message"
+	}
+	return strings.ToUpper(role[:1]) + role[1:]
+}
+
+func toolLabel(block llm.Block) string {
+	switch {
+	case block.Name != "" && block.ID != "":
+		return fmt.Sprintf("%s (%s)", block.Name, block.ID)
+	case block.Name != "":
+		return block.Name
+	}
+	return block.ID
+}
+
+func printIndentedJSON(v any) {
+	if s, ok := v.(string); ok {
+		fmt.Println(indent(s))
+		return
+	}
+	if data, err := json.MarshalIndent(v, "  ", "  "); err == nil {
+		fmt.Println("  " + string(data))
+	}
+}
+
+func indent(text string) string {
+	return "  " + strings.ReplaceAll(text, "\n", "\n  ")
+}
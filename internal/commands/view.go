@@ -1,140 +1,99 @@
 package commands
 
 import (
-	"bufio"
 	"bytes"
 	"compress/gzip"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/llmite-ai/mirra/internal/recorder"
+	"github.com/llmite-ai/mirra/internal/sse"
 )
 
 func View(args []string) error {
 	fs := flag.NewFlagSet("view", flag.ExitOnError)
 	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+	transcript := fs.Bool("transcript", false, "Show the conversation instead of the raw request and response")
+	whereExpr := fs.String("where", "", `Only consider recordings matching a filter expression, e.g. 'status>=400'`)
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
-	// Find all recording files
-	pattern := filepath.Join(*recordingsPath, "recordings-*.jsonl")
-	files, err := filepath.Glob(pattern)
+	where, err := ParseWhere(*whereExpr)
 	if err != nil {
-		return fmt.Errorf("failed to list recordings: %w", err)
+		return err
 	}
+	filter := Filter{Where: where}
 
-	if len(files) == 0 {
-		return fmt.Errorf("no recordings found in %s", *recordingsPath)
+	show := printRecording
+	if *transcript {
+		show = printTranscript
 	}
 
-	// If no ID provided, show the last recording
+	// If no ID provided, show the last (matching) recording
 	if fs.NArg() < 1 {
-		fmt.Fprintf(os.Stderr, "Warning: No recording ID provided, showing last recording\n\n")
-		lastRecording, err := findLastRecording(files)
+		lastRecording, err := LastRecording(*recordingsPath, filter)
 		if err != nil {
 			return err
 		}
-		printRecording(lastRecording)
+		fmt.Fprintf(os.Stderr, "Warning: No recording ID provided, showing last recording\n\n")
+		show(lastRecording)
 		return nil
 	}
 
 	recordingID := fs.Arg(0)
 
 	// Search for the recording (supports partial UUID matching)
-	var matches []recorder.Recording
-	for _, file := range files {
-		f, err := os.Open(file)
-		if err != nil {
-			continue
-		}
-
-		scanner := bufio.NewScanner(f)
-		// Increase buffer size to handle large recordings (default is 64KB)
-		const maxScanTokenSize = 10 * 1024 * 1024 // 10MB
-		buf := make([]byte, maxScanTokenSize)
-		scanner.Buffer(buf, maxScanTokenSize)
-
-		for scanner.Scan() {
-			var rec recorder.Recording
-			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
-				continue
-			}
-
-			// Support both exact match and prefix match
-			if rec.ID == recordingID || len(rec.ID) >= len(recordingID) && rec.ID[:len(recordingID)] == recordingID {
-				matches = append(matches, rec)
-			}
-		}
-
-		f.Close()
-	}
-
-	if len(matches) == 0 {
-		return fmt.Errorf("recording not found: %s", recordingID)
-	}
-
-	if len(matches) > 1 {
+	rec, err := FindRecording(*recordingsPath, recordingID, filter)
+	var ambiguous *AmbiguousIDError
+	if errors.As(err, &ambiguous) {
 		fmt.Printf("error: ambiguous recording ID '%s' matches multiple recordings:\n", recordingID)
-		for _, m := range matches {
-			fmt.Printf("  %s\n", m.ID)
+		for _, id := range ambiguous.Matches {
+			fmt.Printf("  %s\n", id)
 		}
 		return fmt.Errorf("please provide more characters to uniquely identify the recording")
 	}
-
-	printRecording(&matches[0])
-	return nil
-}
-
-func findLastRecording(files []string) (*recorder.Recording, error) {
-	var lastRecording *recorder.Recording
-
-	for _, file := range files {
-		f, err := os.Open(file)
-		if err != nil {
-			continue
-		}
-
-		scanner := bufio.NewScanner(f)
-		// Increase buffer size to handle large recordings (default is 64KB)
-		const maxScanTokenSize = 10 * 1024 * 1024 // 10MB
-		buf := make([]byte, maxScanTokenSize)
-		scanner.Buffer(buf, maxScanTokenSize)
-
-		for scanner.Scan() {
-			var rec recorder.Recording
-			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
-				continue
-			}
-
-			if lastRecording == nil || rec.Timestamp.After(lastRecording.Timestamp) {
-				recCopy := rec
-				lastRecording = &recCopy
-			}
-		}
-
-		f.Close()
-	}
-
-	if lastRecording == nil {
-		return nil, fmt.Errorf("no valid recordings found")
+	if err != nil {
+		return err
 	}
 
-	return lastRecording, nil
+	show(rec)
+	return nil
 }
 
 func printRecording(rec *recorder.Recording) {
 	fmt.Printf("=== Recording %s ===\n", rec.ID)
 	fmt.Printf("Timestamp: %s\n", rec.Timestamp.Format(time.RFC3339))
 	fmt.Printf("Provider: %s\n", rec.Provider)
+	if rec.Client != "" {
+		fmt.Printf("Client: %s\n", rec.Client)
+	}
+	if rec.Model != "" {
+		fmt.Printf("Model: %s\n", rec.Model)
+	}
+	if rec.Usage != nil {
+		fmt.Printf("Tokens: %d in / %d out / %d total\n",
+			rec.Usage.InputTokens, rec.Usage.OutputTokens, rec.Usage.TotalTokens)
+	}
+	if rec.RateLimited {
+		fmt.Println("Rate Limited: true")
+	}
+	if rec.CacheHit {
+		fmt.Println("Cache Hit: true")
+	}
+	if rec.Outcome != "" && rec.Outcome != recorder.OutcomeCompleted {
+		fmt.Printf("Outcome: %s (%s)\n", rec.Outcome, rec.Error)
+		fmt.Printf("Bytes Delivered: %d\n", rec.BytesDelivered)
+	}
 	fmt.Printf("Duration: %dms\n\n", rec.Timing.DurationMs)
 
 	fmt.Println("--- Request ---")
@@ -144,32 +103,20 @@ func printRecording(rec *recorder.Recording) {
 		fmt.Printf("Query: %s\n", redactSensitiveQueryParams(rec.Request.Query))
 	}
 
-	if len(rec.Request.Headers) > 0 {
-		fmt.Println("Headers:")
-		for key, values := range rec.Request.Headers {
-			for _, value := range values {
-				// Redact authorization headers
-				if key == "Authorization" || key == "X-Api-Key" {
-					fmt.Printf("  %s: [REDACTED]\n", key)
-				} else {
-					fmt.Printf("  %s: %s\n", key, value)
-				}
-			}
-		}
-	}
+	printRequestHeadersAndBody(&rec.Request)
 
-	if rec.Request.Body != nil {
-		fmt.Println("Body:")
-		if bodyBytes, err := json.MarshalIndent(rec.Request.Body, "  ", "  "); err == nil {
-			fmt.Println(string(bodyBytes))
-		} else {
-			fmt.Printf("%v\n", rec.Request.Body)
-		}
+	if rec.Forwarded != nil {
+		fmt.Println("\n--- Forwarded Request (rewritten) ---")
+		fmt.Printf("Path: %s\n", rec.Forwarded.Path)
+		printRequestHeadersAndBody(rec.Forwarded)
 	}
 
 	fmt.Println("\n--- Response ---")
 	fmt.Printf("Status: %d\n", rec.Response.Status)
 	fmt.Printf("Streaming: %t\n", rec.Response.Streaming)
+	if rec.Response.ContentEncoding != "" {
+		fmt.Printf("Decoded From: %s\n", rec.Response.ContentEncoding)
+	}
 
 	if len(rec.Response.Headers) > 0 {
 		fmt.Println("Headers:")
@@ -183,8 +130,9 @@ func printRecording(rec *recorder.Recording) {
 	if rec.Response.Body != nil {
 		fmt.Println("Body:")
 
-		// Check if response is gzipped
-		isGzipped := isGzipEncoded(rec.Response.Headers)
+		// Recordings made before bodies were decoded at record time keep
+		// gzip responses as base64
+		isGzipped := isGzipEncoded(rec.Response.Headers) && rec.Response.ContentEncoding == ""
 
 		if rec.Response.Streaming {
 			// Handle streaming SSE format
@@ -208,6 +156,129 @@ func printRecording(rec *recorder.Recording) {
 			}
 		}
 	}
+	printExternalBody(rec.Response.ExternalBody)
+
+	if rec.Response.Reassembled != nil {
+		fmt.Println("Reassembled:")
+		if bodyBytes, err := json.MarshalIndent(rec.Response.Reassembled, "  ", "  "); err == nil {
+			fmt.Println(string(bodyBytes))
+		}
+	}
+
+	if len(rec.Frames) > 0 {
+		fmt.Printf("\n--- WebSocket Frames (%d) ---\n", len(rec.Frames))
+		for _, frame := range rec.Frames {
+			printFrame(frame)
+		}
+	}
+}
+
+// printFrame prints one recorded WebSocket frame on a single line
+func printFrame(frame recorder.Frame) {
+	arrow := "→"
+	if frame.Direction == "server" {
+		arrow = "←"
+	}
+	line := fmt.Sprintf("%s %s %s %d bytes", frame.Timestamp.Format("15:04:05.000"), arrow, frame.Type, frame.Size)
+	switch {
+	case frame.Truncated:
+		line += " (not stored)"
+	case frame.Data != nil:
+		if data, err := json.Marshal(frame.Data); err == nil {
+			line += " " + string(data)
+		}
+	}
+	fmt.Println(line)
+}
+
+// printExternalBody notes where a body that is not stored inline went
+func printExternalBody(o recorder.ExternalBody) {
+	switch {
+	case o.BodyFile != "":
+		fmt.Printf("Body: %d bytes, stored in %s (relative to the recordings directory)\n", o.BodySize, o.BodyFile)
+	case o.BodyTruncated:
+		fmt.Printf("Body truncated: original size %d bytes\n", o.BodySize)
+	}
+}
+
+// printRequestHeadersAndBody prints request headers, redacting credentials,
+// followed by the pretty-printed body
+func printRequestHeadersAndBody(req *recorder.RequestData) {
+	if len(req.Headers) > 0 {
+		fmt.Println("Headers:")
+		for key, values := range req.Headers {
+			for _, value := range values {
+				// Redact authorization headers
+				if isSensitiveHeader(key) {
+					fmt.Printf("  %s: [REDACTED]\n", key)
+				} else {
+					fmt.Printf("  %s: %s\n", key, value)
+				}
+			}
+		}
+	}
+
+	if req.Body != nil {
+		fmt.Println("Body:")
+		if bodyBytes, err := json.MarshalIndent(req.Body, "  ", "  "); err == nil {
+			fmt.Println(string(bodyBytes))
+		} else {
+			fmt.Printf("%v\n", req.Body)
+		}
+	}
+	if len(req.Parts) > 0 {
+		fmt.Println("Parts:")
+		for _, part := range req.Parts {
+			printPart(part)
+		}
+	}
+	printExternalBody(req.ExternalBody)
+}
+
+// printPart prints one multipart field: its value, or where its content went
+func printPart(part recorder.Part) {
+	name := part.Name
+	if part.Filename != "" {
+		name += fmt.Sprintf(" (%s)", part.Filename)
+	}
+	switch {
+	case part.BodyFile != "":
+		fmt.Printf("  %s: %s, %d bytes, stored in %s\n", name, part.ContentType, part.Size, part.BodyFile)
+	case part.Value != "" || part.Size == 0:
+		fmt.Printf("  %s: %s\n", name, part.Value)
+	default:
+		fmt.Printf("  %s: %d bytes, not stored\n", name, part.Size)
+	}
+}
+
+// isSensitiveHeader reports whether a header carries credentials
+func isSensitiveHeader(key string) bool {
+	switch http.CanonicalHeaderKey(key) {
+	case "Authorization", "X-Api-Key", "Proxy-Authorization", "X-Goog-Api-Key":
+		return true
+	}
+	return false
+}
+
+// Redact replaces credentials in a recording's request headers and query
+// with [REDACTED], as view does when printing
+func Redact(rec *recorder.Recording) {
+	for _, req := range []*recorder.RequestData{&rec.Request, rec.Forwarded} {
+		if req == nil {
+			continue
+		}
+		headers := make(map[string][]string, len(req.Headers))
+		for key, values := range req.Headers {
+			if isSensitiveHeader(key) {
+				values = []string{"[REDACTED]"}
+			}
+			headers[key] = values
+		}
+		req.Headers = headers
+		if req.Query != "" {
+			req.Query = redactSensitiveQueryParams(req.Query)
+		}
+	}
 }
 
 // redactSensitiveQueryParams redacts sensitive query parameters like API keys
@@ -237,36 +308,12 @@ func redactSensitiveQueryParams(query string) string {
 
 // printSSEBody parses and formats Server-Sent Events (SSE) format for better readability
 func printSSEBody(body string) {
-	lines := strings.Split(body, "\n")
-	var currentEvent string
-	var currentData strings.Builder
-
-	for _, line := range lines {
-		// SSE format: "event: event_name" and "data: json_payload"
-		if strings.HasPrefix(line, "event: ") {
-			// Print previous event if exists
-			if currentEvent != "" && currentData.Len() > 0 {
-				printSSEEvent(currentEvent, currentData.String())
-				currentData.Reset()
-			}
-			currentEvent = strings.TrimPrefix(line, "event: ")
-		} else if strings.HasPrefix(line, "data: ") {
-			dataContent := strings.TrimPrefix(line, "data: ")
-			if currentData.Len() > 0 {
-				currentData.WriteString("\n")
-			}
-			currentData.WriteString(dataContent)
-		} else if line == "" && currentEvent != "" && currentData.Len() > 0 {
-			// Empty line signals end of event
-			printSSEEvent(currentEvent, currentData.String())
-			currentEvent = ""
-			currentData.Reset()
+	for _, event := range sse.Parse(body) {
+		eventType := event.Type
+		if eventType == "" {
+			eventType = "message"
 		}
-	}
-
-	// Print last event if exists
-	if currentEvent != "" && currentData.Len() > 0 {
-		printSSEEvent(currentEvent, currentData.String())
+		printSSEEvent(eventType, event.Data)
 	}
 }
 
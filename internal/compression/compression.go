@@ -0,0 +1,100 @@
+// Package compression decodes HTTP content codings so recorded bodies can be
+// stored in readable form.
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrTooLarge is returned when the decoded body would exceed the size limit
+var ErrTooLarge = errors.New("decoded body exceeds size limit")
+
+// Decode reverses the Content-Encoding header value applied to data, which
+// may list several codings in the order they were applied. Decoded output is
+// limited to maxSize bytes (0 means no limit) to guard against compression
+// bombs. "identity" and an empty encoding return data unchanged.
+func Decode(encoding string, data []byte, maxSize int64) ([]byte, error) {
+	codings := strings.Split(encoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		if coding == "" || coding == "identity" {
+			continue
+		}
+
+		decoded, err := decodeOne(coding, data, maxSize)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", coding, err)
+		}
+		data = decoded
+	}
+	return data, nil
+}
+
+// IsIdentity reports whether a Content-Encoding header value leaves the body
+// unencoded
+func IsIdentity(encoding string) bool {
+	for _, coding := range strings.Split(encoding, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "" && coding != "identity" {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeOne(coding string, data []byte, maxSize int64) ([]byte, error) {
+	var r io.Reader
+	switch coding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case "deflate":
+		// "deflate" is meant to be zlib-wrapped, but some servers send raw
+		// DEFLATE data
+		if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+			defer zr.Close()
+			r = zr
+		} else {
+			fr := flate.NewReader(bytes.NewReader(data))
+			defer fr.Close()
+			r = fr
+		}
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(data))
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("unsupported content encoding")
+	}
+
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && int64(len(decoded)) > maxSize {
+		return nil, ErrTooLarge
+	}
+	return decoded, nil
+}
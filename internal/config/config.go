@@ -2,15 +2,32 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path"
 	"strconv"
+	"strings"
 )
 
 type Config struct {
-	Port      int                  `json:"port"`
-	Recording RecordingConfig      `json:"recording"`
-	Logging   LoggingConfig        `json:"logging"`
-	Providers map[string]Provider  `json:"providers"`
+	Port      int                 `json:"port"`
+	Listen    string              `json:"listen"` // "host:port" or "unix:/path"; overrides port
+	Timeouts  TimeoutConfig       `json:"timeouts"`
+	Upstream  UpstreamConfig      `json:"upstream"`
+	Recording RecordingConfig     `json:"recording"`
+	Logging   LoggingConfig       `json:"logging"`
+	Metrics   MetricsConfig       `json:"metrics"`
+	Tracing   TracingConfig       `json:"tracing"`
+	Admin     AdminConfig         `json:"admin"`
+	TLS       TLSConfig           `json:"tls"`
+	Auth      AuthConfig          `json:"auth"`
+	Limits    []LimitRule         `json:"limits"`
+	Cache     CacheConfig         `json:"cache"`
+	Rewrites  []RewriteRule       `json:"rewrites"`
+	Forward   ForwardProxyConfig  `json:"forward_proxy"`
+	Providers map[string]Provider `json:"providers"`
 }
 
 type RecordingConfig struct {
@@ -18,6 +35,10 @@ type RecordingConfig struct {
 	Storage string `json:"storage"`
 	Path    string `json:"path"`
 	Format  string `json:"format"`
+	// MaxBodyBytes caps how much of each body is held in memory (0 means
+	// no cap). Larger bodies are handled according to LargeBodies.
+	MaxBodyBytes int64  `json:"max_body_bytes"`
+	LargeBodies  string `json:"large_bodies"` // "spill" to disk or "truncate"
 }
 
 type LoggingConfig struct {
@@ -25,23 +46,223 @@ type LoggingConfig struct {
 	Level  string `json:"level"`  // "debug", "info", "warn", "error"
 }
 
+// MetricsConfig controls the Prometheus /metrics endpoint
+type MetricsConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// TracingConfig controls OpenTelemetry span export over OTLP/HTTP
+type TracingConfig struct {
+	Enabled bool `json:"enabled"`
+	// Endpoint is the collector URL, e.g. "http://localhost:4318". When
+	// empty, the OTEL_EXPORTER_OTLP_* environment variables apply.
+	Endpoint    string            `json:"endpoint"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ServiceName string            `json:"service_name"`
+	// SampleRatio is the fraction of new traces sampled; calls that join an
+	// incoming trace follow the caller's sampling decision
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+// AdminConfig enables the admin API, served on its own listener so it can
+// stay private while the proxy is exposed
+type AdminConfig struct {
+	Enabled bool   `json:"enabled"`
+	Listen  string `json:"listen"`          // "host:port" or "unix:/path"
+	Token   string `json:"token,omitempty"` // required as a bearer token when set
+}
+
+// TimeoutConfig holds server and upstream timeouts in seconds. There is
+// deliberately no overall request timeout so long-running streams are never
+// cut off.
+type TimeoutConfig struct {
+	ReadHeaderSeconds int `json:"read_header_seconds"` // client request headers
+	IdleSeconds       int `json:"idle_seconds"`        // idle client keep-alive connections
+	UpstreamSeconds   int `json:"upstream_seconds"`    // wait for upstream response headers
+	ShutdownSeconds   int `json:"shutdown_seconds"`    // graceful shutdown deadline
+}
+
+// UpstreamConfig tunes the connection pool used for upstream requests
+type UpstreamConfig struct {
+	MaxIdleConns        int  `json:"max_idle_conns"`          // across all hosts
+	MaxIdleConnsPerHost int  `json:"max_idle_conns_per_host"` // per upstream host
+	IdleConnSeconds     int  `json:"idle_conn_seconds"`       // before an idle connection is closed
+	HTTP2               bool `json:"http2"`
+	// Prewarm opens a connection to every upstream at startup and keeps it
+	// alive, so the first requests skip the TCP and TLS handshakes
+	Prewarm bool `json:"prewarm"`
+}
+
+// TLSConfig controls HTTPS on the proxy listener. When enabled without a
+// certificate, a self-signed certificate is generated for local development.
+type TLSConfig struct {
+	Enabled  bool   `json:"enabled"`
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// ClientCAFile enables mutual TLS; client certificates signed by these
+	// CAs are verified and their common name is used as the client name
+	ClientCAFile      string `json:"client_ca_file"`
+	RequireClientCert bool   `json:"require_client_cert"`
+}
+
+// AuthConfig controls authentication of proxy traffic. Clients present their
+// credentials in the Proxy-Authorization header, which is never forwarded
+// upstream, or a TLS client certificate when tls.client_ca_file is set.
+type AuthConfig struct {
+	Enabled bool           `json:"enabled"`
+	Clients []ClientConfig `json:"clients"`
+}
+
+// ClientConfig maps a set of credentials to a client name. A client
+// authenticates with either a bearer token or a username/password pair.
+type ClientConfig struct {
+	Name     string `json:"name"`
+	Token    string `json:"token,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// LimitRule caps request rate and token consumption. Client, Provider and
+// Model select which traffic the rule applies to:
+//   - "" matches everything and the budget is shared by all matching traffic
+//   - "*" matches everything but tracks a separate budget per distinct value
+//   - anything else is a glob pattern (e.g. "claude-*") sharing one budget
+type LimitRule struct {
+	Client            string `json:"client,omitempty"`
+	Provider          string `json:"provider,omitempty"`
+	Model             string `json:"model,omitempty"`
+	RequestsPerMinute int    `json:"requests_per_minute,omitempty"`
+	TokensPerDay      int64  `json:"tokens_per_day,omitempty"`
+}
+
+// CacheConfig controls the response cache for deterministic requests
+// (temperature 0, or opted in with the X-Mirra-Cache: on header).
+type CacheConfig struct {
+	Enabled    bool   `json:"enabled"`
+	Backend    string `json:"backend"` // "memory" or "disk"
+	Path       string `json:"path"`    // directory for the disk backend
+	TTLSeconds int    `json:"ttl_seconds"`
+	MaxEntries int    `json:"max_entries"`
+	MaxBytes   int64  `json:"max_bytes"`
+}
+
+// RewriteRule transforms matching requests before they are forwarded.
+// Provider and Path (a prefix) narrow which requests the rule applies to;
+// Client is a glob pattern matched against the authenticated client name.
+type RewriteRule struct {
+	Provider         string            `json:"provider,omitempty"`
+	Client           string            `json:"client,omitempty"`
+	Path             string            `json:"path,omitempty"`
+	SetHeaders       map[string]string `json:"set_headers,omitempty"`
+	RemoveHeaders    []string          `json:"remove_headers,omitempty"`
+	Models           map[string]string `json:"models,omitempty"` // original -> replacement
+	DefaultMaxTokens int               `json:"default_max_tokens,omitempty"`
+	StripFields      []string          `json:"strip_fields,omitempty"` // dotted paths, e.g. "generationConfig.topK"
+}
+
+// ForwardProxyConfig enables HTTP(S) forward-proxy mode, where clients use
+// MIRRA via HTTPS_PROXY and TLS to known LLM hosts is terminated with a
+// locally generated CA.
+type ForwardProxyConfig struct {
+	Enabled bool   `json:"enabled"`
+	CADir   string `json:"ca_dir"`
+	// Hosts maps additional hostnames to intercept onto a provider
+	Hosts map[string]string `json:"hosts,omitempty"`
+	// AllowTunnel passes CONNECT requests for other hosts through as opaque
+	// tunnels instead of rejecting them
+	AllowTunnel bool `json:"allow_tunnel"`
+}
+
+// defaultInterceptHosts are the public API hosts of the supported providers
+var defaultInterceptHosts = map[string]string{
+	"api.anthropic.com":                 "claude",
+	"api.openai.com":                    "openai",
+	"generativelanguage.googleapis.com": "gemini",
+}
+
+// InterceptHosts returns the lowercased hosts whose TLS is terminated in
+// forward-proxy mode, mapped to their provider: the providers' public API
+// hosts plus Hosts
+func (f ForwardProxyConfig) InterceptHosts() map[string]string {
+	hosts := make(map[string]string, len(defaultInterceptHosts)+len(f.Hosts))
+	for host, provider := range defaultInterceptHosts {
+		hosts[host] = provider
+	}
+	for host, provider := range f.Hosts {
+		hosts[strings.ToLower(host)] = provider
+	}
+	return hosts
+}
+
+// Provider configures where a provider's traffic is sent and how the
+// connection to the upstream is made
 type Provider struct {
 	UpstreamURL string `json:"upstream_url"`
+	// Proxy is the egress proxy URL. When empty, HTTPS_PROXY, HTTP_PROXY and
+	// NO_PROXY from the environment apply; "direct" bypasses any proxy.
+	Proxy string `json:"proxy,omitempty"`
+	// CAFile adds PEM root certificates, such as a TLS-inspecting proxy's
+	// CA, to the system roots
+	CAFile string `json:"ca_file,omitempty"`
+	// ClientCertFile and ClientKeyFile present a client certificate
+	ClientCertFile string `json:"client_cert_file,omitempty"`
+	ClientKeyFile  string `json:"client_key_file,omitempty"`
+	// InsecureSkipVerify disables certificate verification. It is only
+	// allowed for loopback upstreams, such as a local stand-in server.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
 }
 
 func Load(path string) (*Config, error) {
 	cfg := &Config{
 		Port: 4567,
+		Timeouts: TimeoutConfig{
+			ReadHeaderSeconds: 10,
+			IdleSeconds:       120,
+			UpstreamSeconds:   300,
+			ShutdownSeconds:   5,
+		},
+		Upstream: UpstreamConfig{
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 32,
+			IdleConnSeconds:     90,
+			HTTP2:               true,
+		},
 		Recording: RecordingConfig{
-			Enabled: true,
-			Storage: "file",
-			Path:    "./recordings",
-			Format:  "jsonl",
+			Enabled:      true,
+			Storage:      "file",
+			Path:         "./recordings",
+			Format:       "jsonl",
+			MaxBodyBytes: 16 << 20,
+			LargeBodies:  "spill",
 		},
 		Logging: LoggingConfig{
 			Format: "pretty",
 			Level:  "info",
 		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+		},
+		Admin: AdminConfig{
+			Enabled: false,
+			Listen:  "127.0.0.1:4568",
+		},
+		Tracing: TracingConfig{
+			Enabled:     false,
+			ServiceName: "mirra",
+			SampleRatio: 1,
+		},
+		Forward: ForwardProxyConfig{
+			Enabled: false,
+			CADir:   "./ca",
+		},
+		Cache: CacheConfig{
+			Enabled:    false,
+			Backend:    "memory",
+			Path:       "./cache",
+			TTLSeconds: 3600,
+			MaxEntries: 10000,
+			MaxBytes:   256 * 1024 * 1024,
+		},
 		Providers: map[string]Provider{
 			"claude": {UpstreamURL: "https://api.anthropic.com"},
 			"openai": {UpstreamURL: "https://api.openai.com"},
@@ -63,10 +284,14 @@ func Load(path string) (*Config, error) {
 	// Override with environment variables
 	if port := os.Getenv("MIRRA_PORT"); port != "" {
 		if p, err := strconv.Atoi(port); err == nil {
-			cfg.Port = p
+			cfg.SetPort(p)
 		}
 	}
 
+	if listen := os.Getenv("MIRRA_LISTEN"); listen != "" {
+		cfg.Listen = listen
+	}
+
 	if enabled := os.Getenv("MIRRA_RECORDING_ENABLED"); enabled != "" {
 		cfg.Recording.Enabled = enabled == "true"
 	}
@@ -75,26 +300,224 @@ func Load(path string) (*Config, error) {
 		cfg.Recording.Path = recordingPath
 	}
 
+	if certFile := os.Getenv("MIRRA_TLS_CERT_FILE"); certFile != "" {
+		cfg.TLS.Enabled = true
+		cfg.TLS.CertFile = certFile
+	}
+
+	if keyFile := os.Getenv("MIRRA_TLS_KEY_FILE"); keyFile != "" {
+		cfg.TLS.KeyFile = keyFile
+	}
+
 	if claudeUpstream := os.Getenv("MIRRA_CLAUDE_UPSTREAM"); claudeUpstream != "" {
 		if cfg.Providers == nil {
 			cfg.Providers = make(map[string]Provider)
 		}
-		cfg.Providers["claude"] = Provider{UpstreamURL: claudeUpstream}
+		provider := cfg.Providers["claude"]
+		provider.UpstreamURL = claudeUpstream
+		cfg.Providers["claude"] = provider
 	}
 
 	if openaiUpstream := os.Getenv("MIRRA_OPENAI_UPSTREAM"); openaiUpstream != "" {
 		if cfg.Providers == nil {
 			cfg.Providers = make(map[string]Provider)
 		}
-		cfg.Providers["openai"] = Provider{UpstreamURL: openaiUpstream}
+		provider := cfg.Providers["openai"]
+		provider.UpstreamURL = openaiUpstream
+		cfg.Providers["openai"] = provider
 	}
 
 	if geminiUpstream := os.Getenv("MIRRA_GEMINI_UPSTREAM"); geminiUpstream != "" {
 		if cfg.Providers == nil {
 			cfg.Providers = make(map[string]Provider)
 		}
-		cfg.Providers["gemini"] = Provider{UpstreamURL: geminiUpstream}
+		provider := cfg.Providers["gemini"]
+		provider.UpstreamURL = geminiUpstream
+		cfg.Providers["gemini"] = provider
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
 	}
 
 	return cfg, nil
 }
+
+// ListenAddress returns the address the server binds to: the configured
+// listen address, or all interfaces on the configured port.
+func (c *Config) ListenAddress() string {
+	if c.Listen != "" {
+		return c.Listen
+	}
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+// SetPort overrides the port, keeping the host of a TCP listen address
+func (c *Config) SetPort(port int) {
+	c.Port = port
+	if c.Listen == "" || strings.HasPrefix(c.Listen, "unix:") {
+		return
+	}
+	if host, _, err := net.SplitHostPort(c.Listen); err == nil {
+		c.Listen = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+}
+
+func (c *Config) validate() error {
+	if err := validateListen(c.Listen); err != nil {
+		return err
+	}
+
+	if c.Admin.Enabled {
+		if c.Admin.Listen == "" {
+			return fmt.Errorf("admin: listen is required")
+		}
+		if err := validateListen(c.Admin.Listen); err != nil {
+			return fmt.Errorf("admin: %w", err)
+		}
+		// Recordings hold prompts, completions and, with raw, credentials
+		if c.Admin.Token == "" && !isLocalListen(c.Admin.Listen) {
+			return fmt.Errorf("admin: token is required when listen (%q) is not a loopback address or Unix socket", c.Admin.Listen)
+		}
+	}
+
+	if c.Upstream.MaxIdleConns < 0 || c.Upstream.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("upstream: idle connection limits must not be negative")
+	}
+	if c.Upstream.Prewarm && c.Upstream.IdleConnSeconds <= 0 {
+		return fmt.Errorf("upstream: prewarm needs idle_conn_seconds")
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing: sample_ratio must be between 0 and 1")
+	}
+
+	if c.Recording.MaxBodyBytes < 0 {
+		return fmt.Errorf("recording: max_body_bytes must not be negative")
+	}
+	switch c.Recording.LargeBodies {
+	case "spill", "truncate":
+	default:
+		return fmt.Errorf("recording: unknown large_bodies mode %q (want spill or truncate)", c.Recording.LargeBodies)
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls: cert_file and key_file must be set together")
+	}
+	if c.TLS.RequireClientCert && c.TLS.ClientCAFile == "" {
+		return fmt.Errorf("tls: require_client_cert needs client_ca_file")
+	}
+	if c.TLS.ClientCAFile != "" && !c.TLS.Enabled {
+		return fmt.Errorf("tls: client_ca_file requires tls to be enabled")
+	}
+
+	if c.Auth.Enabled {
+		if len(c.Auth.Clients) == 0 && c.TLS.ClientCAFile == "" {
+			return fmt.Errorf("auth is enabled but no clients or client_ca_file are configured")
+		}
+
+		for i, client := range c.Auth.Clients {
+			if client.Name == "" {
+				return fmt.Errorf("auth client %d: name is required", i)
+			}
+			if client.Token == "" && client.Username == "" {
+				return fmt.Errorf("auth client %q: token or username is required", client.Name)
+			}
+			if client.Token != "" && client.Username != "" {
+				return fmt.Errorf("auth client %q: token and username are mutually exclusive", client.Name)
+			}
+		}
+	}
+
+	for i, rule := range c.Limits {
+		if rule.RequestsPerMinute <= 0 && rule.TokensPerDay <= 0 {
+			return fmt.Errorf("limit %d: requests_per_minute or tokens_per_day is required", i)
+		}
+		for _, pattern := range []string{rule.Client, rule.Provider, rule.Model} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("limit %d: invalid pattern %q: %w", i, pattern, err)
+			}
+		}
+	}
+
+	for i, rule := range c.Rewrites {
+		if _, err := path.Match(rule.Client, ""); err != nil {
+			return fmt.Errorf("rewrite %d: invalid client pattern %q: %w", i, rule.Client, err)
+		}
+	}
+
+	for name, provider := range c.Providers {
+		if err := provider.validate(); err != nil {
+			return fmt.Errorf("provider %s: %w", name, err)
+		}
+	}
+
+	for host, provider := range c.Forward.Hosts {
+		if _, ok := c.Providers[provider]; !ok {
+			return fmt.Errorf("forward_proxy host %q: unknown provider %q", host, provider)
+		}
+	}
+
+	return nil
+}
+
+func validateListen(addr string) error {
+	if addr != "" && !strings.HasPrefix(addr, "unix:") {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid listen address %q: %w", addr, err)
+		}
+	}
+	return nil
+}
+
+// isLocalListen reports whether a listen address is only reachable from
+// this host: a Unix socket or a loopback address
+func isLocalListen(addr string) bool {
+	if strings.HasPrefix(addr, "unix:") {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (p Provider) validate() error {
+	if p.Proxy != "" && p.Proxy != "direct" {
+		u, err := url.Parse(p.Proxy)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid proxy URL %q", p.Proxy)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+	}
+
+	if (p.ClientCertFile == "") != (p.ClientKeyFile == "") {
+		return fmt.Errorf("client_cert_file and client_key_file must be set together")
+	}
+
+	if p.InsecureSkipVerify {
+		u, err := url.Parse(p.UpstreamURL)
+		if err != nil || !isLoopback(u.Hostname()) {
+			return fmt.Errorf("insecure_skip_verify is only allowed for loopback upstreams, not %q", p.UpstreamURL)
+		}
+	}
+
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,277 @@
+// Package llm extracts provider-specific metadata such as the model name and
+// token usage from recorded request and response bodies.
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/llmite-ai/mirra/internal/recorder"
+	"github.com/llmite-ai/mirra/internal/sse"
+)
+
+// Model returns the model targeted by a request. Claude and OpenAI carry the
+// model in the request body, Gemini carries it in the path
+// (e.g. /v1beta/models/gemini-2.5-pro:generateContent).
+func Model(provider, path string, body any) string {
+	switch provider {
+	case "gemini":
+		return geminiModel(path)
+	default:
+		if m, ok := body.(map[string]any); ok {
+			if model, ok := m["model"].(string); ok {
+				return model
+			}
+		}
+		return ""
+	}
+}
+
+func geminiModel(path string) string {
+	for _, prefix := range []string{"/models/", "/tunedModels/"} {
+		idx := strings.Index(path, prefix)
+		if idx < 0 {
+			continue
+		}
+		model := path[idx+len(prefix):]
+		if end := strings.IndexAny(model, ":/"); end >= 0 {
+			model = model[:end]
+		}
+		return model
+	}
+	return ""
+}
+
+// Operation names the kind of call a request makes, using the OpenTelemetry
+// GenAI operation names ("chat", "text_completion", "embeddings",
+// "generate_content"), or "" for other API calls such as file uploads
+func Operation(provider, path string) string {
+	switch provider {
+	case "claude":
+		switch {
+		case strings.HasPrefix(path, "/v1/messages/batches"):
+			return ""
+		case strings.HasPrefix(path, "/v1/messages"):
+			return "chat"
+		case strings.HasPrefix(path, "/v1/complete"):
+			return "text_completion"
+		}
+	case "openai":
+		switch {
+		case strings.HasPrefix(path, "/v1/chat/completions"),
+			strings.HasPrefix(path, "/v1/responses"),
+			strings.HasPrefix(path, "/v1/realtime"):
+			return "chat"
+		case strings.HasPrefix(path, "/v1/completions"):
+			return "text_completion"
+		case strings.HasPrefix(path, "/v1/embeddings"):
+			return "embeddings"
+		}
+	case "gemini":
+		switch {
+		case strings.HasSuffix(path, ":generateContent"),
+			strings.HasSuffix(path, ":streamGenerateContent"),
+			strings.HasSuffix(path, "BidiGenerateContent"):
+			return "generate_content"
+		case strings.HasSuffix(path, ":embedContent"),
+			strings.HasSuffix(path, ":batchEmbedContents"):
+			return "embeddings"
+		}
+	}
+	return ""
+}
+
+// Usage extracts token usage from a response body. Streaming bodies are
+// stored in SSE format and are scanned event by event; the last reported
+// counts win since providers report cumulative totals.
+func Usage(provider string, body any, streaming bool) *recorder.Usage {
+	if body == nil {
+		return nil
+	}
+
+	if streaming {
+		s, ok := body.(string)
+		if !ok {
+			return nil
+		}
+		return streamingUsage(provider, s)
+	}
+
+	// Gemini's streamGenerateContent without alt=sse returns a JSON array of
+	// response chunks
+	if chunks, ok := body.([]any); ok {
+		var usage *recorder.Usage
+		for _, chunk := range chunks {
+			if u := chunkUsage(provider, chunk, usage); u != nil {
+				usage = u
+			}
+		}
+		return usage
+	}
+
+	return chunkUsage(provider, body, nil)
+}
+
+func streamingUsage(provider, body string) *recorder.Usage {
+	t := NewUsageTracker(provider)
+	t.Write([]byte(body))
+	return t.Usage()
+}
+
+// UsageTracker reads usage from a streaming response as it is relayed, so
+// usage is known even when the stream is too large to keep in memory
+type UsageTracker struct {
+	provider string
+	parser   sse.Parser
+	usage    *recorder.Usage
+}
+
+func NewUsageTracker(provider string) *UsageTracker {
+	t := &UsageTracker{provider: provider}
+	t.parser.OnEvent = t.onEvent
+	return t
+}
+
+// Write feeds raw stream bytes to the tracker
+func (t *UsageTracker) Write(b []byte) (int, error) {
+	return t.parser.Write(b)
+}
+
+// Usage returns the usage seen so far, or nil if the stream reported none
+func (t *UsageTracker) Usage() *recorder.Usage {
+	t.parser.Close()
+	return t.usage
+}
+
+func (t *UsageTracker) onEvent(event sse.Event) {
+	data := strings.TrimSpace(event.Data)
+	if data == "" || data == "[DONE]" {
+		return
+	}
+
+	var v any
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		return
+	}
+	if u := chunkUsage(t.provider, v, t.usage); u != nil {
+		t.usage = u
+	}
+}
+
+// chunkUsage reads usage from a single response object or stream event.
+// prev holds the usage accumulated so far, which Claude needs because input
+// and output tokens arrive in separate events.
+func chunkUsage(provider string, v any, prev *recorder.Usage) *recorder.Usage {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	switch provider {
+	case "claude":
+		return claudeUsage(m, prev)
+	case "openai":
+		return openaiUsage(m)
+	case "gemini":
+		return geminiUsage(m)
+	}
+	return nil
+}
+
+func claudeUsage(m map[string]any, prev *recorder.Usage) *recorder.Usage {
+	// Streaming: message_start carries the message (with input tokens),
+	// message_delta carries the cumulative output tokens
+	if msg, ok := m["message"].(map[string]any); ok {
+		m = msg
+	}
+
+	u, ok := m["usage"].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	usage := &recorder.Usage{}
+	if prev != nil {
+		*usage = *prev
+	}
+
+	if v, ok := number(u, "input_tokens"); ok {
+		usage.InputTokens = v
+		// Cached prompt tokens are billed separately but still count as input
+		if c, ok := number(u, "cache_creation_input_tokens"); ok {
+			usage.InputTokens += c
+		}
+		if c, ok := number(u, "cache_read_input_tokens"); ok {
+			usage.InputTokens += c
+		}
+	}
+	if v, ok := number(u, "output_tokens"); ok {
+		usage.OutputTokens = v
+	}
+	usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	return usage
+}
+
+func openaiUsage(m map[string]any) *recorder.Usage {
+	// Responses API streams wrap the final response in response.completed
+	if resp, ok := m["response"].(map[string]any); ok {
+		m = resp
+	}
+
+	u, ok := m["usage"].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	usage := &recorder.Usage{}
+	// Chat completions use prompt/completion, the Responses API uses input/output
+	if v, ok := number(u, "prompt_tokens"); ok {
+		usage.InputTokens = v
+	} else if v, ok := number(u, "input_tokens"); ok {
+		usage.InputTokens = v
+	}
+	if v, ok := number(u, "completion_tokens"); ok {
+		usage.OutputTokens = v
+	} else if v, ok := number(u, "output_tokens"); ok {
+		usage.OutputTokens = v
+	}
+	if v, ok := number(u, "total_tokens"); ok {
+		usage.TotalTokens = v
+	} else {
+		usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	}
+	return usage
+}
+
+func geminiUsage(m map[string]any) *recorder.Usage {
+	u, ok := m["usageMetadata"].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	usage := &recorder.Usage{}
+	if v, ok := number(u, "promptTokenCount"); ok {
+		usage.InputTokens = v
+	}
+	if v, ok := number(u, "candidatesTokenCount"); ok {
+		usage.OutputTokens = v
+	}
+	if v, ok := number(u, "thoughtsTokenCount"); ok {
+		usage.OutputTokens += v
+	}
+	if v, ok := number(u, "totalTokenCount"); ok {
+		usage.TotalTokens = v
+	} else {
+		usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	}
+	return usage
+}
+
+// number reads a JSON number field decoded into a map[string]any
+func number(m map[string]any, key string) (int64, bool) {
+	v, ok := m[key].(float64)
+	if !ok {
+		return 0, false
+	}
+	return int64(v), true
+}
@@ -0,0 +1,447 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/llmite-ai/mirra/internal/sse"
+)
+
+// Reassemble folds a streamed response body into the response the provider
+// would have returned without streaming: a Claude Message, an OpenAI
+// ChatCompletion (or Responses API response), or a single Gemini
+// GenerateContentResponse. Streaming bodies are stored in SSE format; Gemini's
+// streamGenerateContent without alt=sse returns a JSON array of chunks
+// instead. It returns nil for bodies that aren't streams.
+func Reassemble(provider string, body any, streaming bool) map[string]any {
+	var chunks []map[string]any
+	switch b := body.(type) {
+	case string:
+		if !streaming {
+			return nil
+		}
+		chunks = streamChunks(b)
+	case []any:
+		if provider != "gemini" {
+			return nil
+		}
+		for _, chunk := range b {
+			if m, ok := chunk.(map[string]any); ok {
+				chunks = append(chunks, m)
+			}
+		}
+	default:
+		return nil
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	switch provider {
+	case "claude":
+		return reassembleClaude(chunks)
+	case "openai":
+		return reassembleOpenAI(chunks)
+	case "gemini":
+		return reassembleGemini(chunks)
+	}
+	return nil
+}
+
+// streamChunks decodes the JSON data of every event in an SSE stream
+func streamChunks(stream string) []map[string]any {
+	var chunks []map[string]any
+	for _, event := range sse.Parse(stream) {
+		data := strings.TrimSpace(event.Data)
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		var m map[string]any
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			continue
+		}
+		chunks = append(chunks, m)
+	}
+	return chunks
+}
+
+// reassembleClaude applies message_start, content_block_start,
+// content_block_delta and message_delta events to build a Message. Tool
+// input arrives as partial JSON and is decoded once complete.
+func reassembleClaude(events []map[string]any) map[string]any {
+	message := map[string]any{"type": "message", "role": "assistant"}
+	var blocks []map[string]any
+	var partialJSON []string
+
+	// block returns the block an event refers to, or nil for an index
+	// that doesn't extend the blocks seen so far by at most one
+	block := func(event map[string]any) (int, map[string]any) {
+		n, _ := number(event, "index")
+		index, ok := streamIndex(n, len(blocks))
+		if !ok {
+			return 0, nil
+		}
+		if index == len(blocks) {
+			blocks = append(blocks, nil)
+			partialJSON = append(partialJSON, "")
+		}
+		if blocks[index] == nil {
+			blocks[index] = map[string]any{}
+		}
+		return index, blocks[index]
+	}
+
+	for _, event := range events {
+		switch event["type"] {
+		case "message_start":
+			if m, ok := event["message"].(map[string]any); ok {
+				for k, v := range m {
+					message[k] = v
+				}
+			}
+		case "content_block_start":
+			_, b := block(event)
+			if b == nil {
+				continue
+			}
+			if start, ok := event["content_block"].(map[string]any); ok {
+				for k, v := range start {
+					b[k] = v
+				}
+			}
+		case "content_block_delta":
+			index, b := block(event)
+			if b == nil {
+				continue
+			}
+			delta, _ := event["delta"].(map[string]any)
+			switch delta["type"] {
+			case "text_delta":
+				appendString(b, "text", delta["text"])
+			case "thinking_delta":
+				appendString(b, "thinking", delta["thinking"])
+			case "signature_delta":
+				appendString(b, "signature", delta["signature"])
+			case "citations_delta":
+				citations, _ := b["citations"].([]any)
+				b["citations"] = append(citations, delta["citation"])
+			case "input_json_delta":
+				if s, ok := delta["partial_json"].(string); ok {
+					partialJSON[index] += s
+				}
+			}
+		case "message_delta":
+			if delta, ok := event["delta"].(map[string]any); ok {
+				for k, v := range delta {
+					message[k] = v
+				}
+			}
+			// message_delta usage is cumulative, updating message_start's counts
+			if u, ok := event["usage"].(map[string]any); ok {
+				usage, _ := message["usage"].(map[string]any)
+				if usage == nil {
+					usage = map[string]any{}
+				}
+				for k, v := range u {
+					if v != nil {
+						usage[k] = v
+					}
+				}
+				message["usage"] = usage
+			}
+		}
+	}
+
+	content := []any{}
+	for i, b := range blocks {
+		if b == nil {
+			continue
+		}
+		if s := partialJSON[i]; s != "" {
+			var input any
+			if err := json.Unmarshal([]byte(s), &input); err == nil {
+				b["input"] = input
+			} else {
+				b["input"] = s // cut off mid-stream
+			}
+		}
+		content = append(content, b)
+	}
+	message["content"] = content
+	return message
+}
+
+// reassembleOpenAI folds chat completion or legacy completion chunks into a
+// ChatCompletion or Completion, joining content and tool call argument
+// fragments by index. Responses API streams end with the whole response in
+// response.completed (or .incomplete or .failed); streams cut off before that
+// are rebuilt from their text deltas.
+func reassembleOpenAI(chunks []map[string]any) map[string]any {
+	if t, _ := chunks[0]["type"].(string); strings.HasPrefix(t, "response.") {
+		return reassembleResponses(chunks)
+	}
+
+	completion := map[string]any{"object": "chat.completion"}
+	var choices []map[string]any
+
+	for _, chunk := range chunks {
+		for _, key := range []string{"id", "created", "model", "system_fingerprint", "service_tier", "usage"} {
+			if v, ok := chunk[key]; ok && v != nil {
+				completion[key] = v
+			}
+		}
+		if chunk["object"] == "text_completion" {
+			completion["object"] = "text_completion"
+		}
+
+		list, _ := chunk["choices"].([]any)
+		for _, c := range list {
+			delta, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			n, _ := number(delta, "index")
+			index, ok := streamIndex(n, len(choices))
+			if !ok {
+				continue
+			}
+			if index == len(choices) {
+				choices = append(choices, map[string]any{
+					"index":   int64(index),
+					"message": map[string]any{"role": "assistant"},
+				})
+			}
+			choice := choices[index]
+			if reason, ok := delta["finish_reason"]; ok && reason != nil {
+				choice["finish_reason"] = reason
+			}
+			if text, ok := delta["text"].(string); ok {
+				appendString(choice, "text", text)
+				delete(choice, "message")
+			}
+			d, ok := delta["delta"].(map[string]any)
+			if !ok {
+				continue
+			}
+			message, ok := choice["message"].(map[string]any)
+			if !ok {
+				continue
+			}
+			if role, ok := d["role"].(string); ok {
+				message["role"] = role
+			}
+			appendString(message, "content", d["content"])
+			appendString(message, "refusal", d["refusal"])
+			if calls, ok := d["tool_calls"].([]any); ok {
+				message["tool_calls"] = mergeToolCalls(message["tool_calls"], calls)
+			}
+		}
+	}
+
+	list := make([]any, len(choices))
+	for i, choice := range choices {
+		if message, ok := choice["message"].(map[string]any); ok {
+			if _, ok := message["content"]; !ok {
+				message["content"] = nil
+			}
+		}
+		list[i] = choice
+	}
+	completion["choices"] = list
+	return completion
+}
+
+// mergeToolCalls applies streamed tool call fragments: the first fragment of
+// each call carries its id, type and name, later ones argument text
+func mergeToolCalls(existing any, fragments []any) []any {
+	calls, _ := existing.([]any)
+	for _, f := range fragments {
+		fragment, ok := f.(map[string]any)
+		if !ok {
+			continue
+		}
+		n, _ := number(fragment, "index")
+		index, ok := streamIndex(n, len(calls))
+		if !ok {
+			continue
+		}
+		if index == len(calls) {
+			calls = append(calls, map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": "", "arguments": ""},
+			})
+		}
+		call, ok := calls[index].(map[string]any)
+		if !ok {
+			continue
+		}
+		if id, ok := fragment["id"].(string); ok && id != "" {
+			call["id"] = id
+		}
+		if typ, ok := fragment["type"].(string); ok && typ != "" {
+			call["type"] = typ
+		}
+		if fn, ok := fragment["function"].(map[string]any); ok {
+			function, ok := call["function"].(map[string]any)
+			if !ok {
+				continue
+			}
+			appendString(function, "name", fn["name"])
+			appendString(function, "arguments", fn["arguments"])
+		}
+	}
+	return calls
+}
+
+func reassembleResponses(events []map[string]any) map[string]any {
+	var response map[string]any
+	var text strings.Builder
+	for _, event := range events {
+		switch event["type"] {
+		case "response.created", "response.in_progress",
+			"response.completed", "response.incomplete", "response.failed":
+			if r, ok := event["response"].(map[string]any); ok {
+				response = r
+			}
+		case "response.output_text.delta":
+			if s, ok := event["delta"].(string); ok {
+				text.WriteString(s)
+			}
+		}
+	}
+	if response == nil {
+		response = map[string]any{"object": "response"}
+	}
+
+	if output, _ := response["output"].([]any); len(output) == 0 && text.Len() > 0 {
+		response["output"] = []any{map[string]any{
+			"type": "message",
+			"role": "assistant",
+			"content": []any{map[string]any{
+				"type": "output_text",
+				"text": text.String(),
+			}},
+		}}
+	}
+	return response
+}
+
+// reassembleGemini merges GenerateContentResponse chunks into one, joining
+// adjacent text parts of each candidate. Usage and finish reasons are taken
+// from the last chunk that has them.
+func reassembleGemini(chunks []map[string]any) map[string]any {
+	merged := map[string]any{}
+	var candidates []map[string]any
+
+	for _, chunk := range chunks {
+		for _, key := range []string{"usageMetadata", "modelVersion", "responseId", "promptFeedback"} {
+			if v, ok := chunk[key]; ok {
+				merged[key] = v
+			}
+		}
+
+		list, _ := chunk["candidates"].([]any)
+		for i, c := range list {
+			candidate, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			n := int64(i)
+			if v, ok := number(candidate, "index"); ok {
+				n = v
+			}
+			index, ok := streamIndex(n, len(candidates))
+			if !ok {
+				continue
+			}
+			if index == len(candidates) {
+				candidates = append(candidates, map[string]any{
+					"content": map[string]any{"role": "model", "parts": []any{}},
+				})
+			}
+			target := candidates[index]
+			for k, v := range candidate {
+				if k != "content" {
+					target[k] = v
+				}
+			}
+
+			content := target["content"].(map[string]any)
+			parts := content["parts"].([]any)
+			if c, ok := candidate["content"].(map[string]any); ok {
+				if role, ok := c["role"].(string); ok {
+					content["role"] = role
+				}
+				newParts, _ := c["parts"].([]any)
+				for _, p := range newParts {
+					parts = appendGeminiPart(parts, p)
+				}
+			}
+			content["parts"] = parts
+		}
+	}
+
+	list := make([]any, len(candidates))
+	for i, candidate := range candidates {
+		list[i] = candidate
+	}
+	merged["candidates"] = list
+	return merged
+}
+
+// appendGeminiPart adds a part, joining text onto the previous part when both
+// are plain text or both are thought summaries
+func appendGeminiPart(parts []any, p any) []any {
+	part, ok := p.(map[string]any)
+	if !ok {
+		return parts
+	}
+	if len(parts) > 0 {
+		if last, ok := parts[len(parts)-1].(map[string]any); ok &&
+			isPlainText(last) && isPlainText(part) && last["thought"] == part["thought"] {
+			last["text"] = last["text"].(string) + part["text"].(string)
+			return parts
+		}
+	}
+
+	copied := make(map[string]any, len(part))
+	for k, v := range part {
+		copied[k] = v
+	}
+	return append(parts, copied)
+}
+
+// isPlainText reports whether a Gemini part holds only text, which may be a
+// thought summary
+func isPlainText(part map[string]any) bool {
+	if _, ok := part["text"].(string); !ok {
+		return false
+	}
+	for k := range part {
+		if k != "text" && k != "thought" {
+			return false
+		}
+	}
+	return true
+}
+
+// appendString appends a string delta to a field, ignoring non-strings
+func appendString(m map[string]any, key string, delta any) {
+	s, ok := delta.(string)
+	if !ok {
+		return
+	}
+	prev, _ := m[key].(string)
+	m[key] = prev + s
+}
+
+// streamIndex validates an index taken from stream data against the items
+// reassembled so far: it may refer to an existing item or add the next one.
+// Anything else is malformed and would otherwise panic or allocate without
+// bound.
+func streamIndex(n int64, length int) (int, bool) {
+	if n < 0 || n > int64(length) {
+		return 0, false
+	}
+	return int(n), true
+}
@@ -0,0 +1,89 @@
+package llm
+
+// StopReason returns why generation stopped, as the provider reports it in
+// a complete (or reassembled) response: Claude's stop_reason, OpenAI's
+// finish_reason or Responses API status, or Gemini's finishReason
+func StopReason(provider string, response any) string {
+	m, ok := response.(map[string]any)
+	if !ok {
+		return ""
+	}
+
+	switch provider {
+	case "claude":
+		reason, _ := m["stop_reason"].(string)
+		return reason
+	case "openai":
+		if choice := firstChoice(m); choice != nil {
+			reason, _ := choice["finish_reason"].(string)
+			return reason
+		}
+		// Responses API: incomplete responses say why
+		if details, ok := m["incomplete_details"].(map[string]any); ok {
+			if reason, ok := details["reason"].(string); ok {
+				return reason
+			}
+		}
+		status, _ := m["status"].(string)
+		return status
+	case "gemini":
+		if candidate := firstCandidate(m); candidate != nil {
+			reason, _ := candidate["finishReason"].(string)
+			return reason
+		}
+	}
+	return ""
+}
+
+// ToolCalls counts the tool calls in a complete (or reassembled) response
+func ToolCalls(provider string, response any) int {
+	m, ok := response.(map[string]any)
+	if !ok {
+		return 0
+	}
+
+	count := 0
+	switch provider {
+	case "claude":
+		blocks, _ := m["content"].([]any)
+		for _, b := range blocks {
+			if block, ok := b.(map[string]any); ok && block["type"] == "tool_use" {
+				count++
+			}
+		}
+	case "openai":
+		if choice := firstChoice(m); choice != nil {
+			if msg, ok := choice["message"].(map[string]any); ok {
+				calls, _ := msg["tool_calls"].([]any)
+				count = len(calls)
+			}
+			break
+		}
+		output, _ := m["output"].([]any)
+		for _, item := range output {
+			if it, ok := item.(map[string]any); ok && it["type"] == "function_call" {
+				count++
+			}
+		}
+	case "gemini":
+		if candidate := firstCandidate(m); candidate != nil {
+			content, _ := candidate["content"].(map[string]any)
+			parts, _ := content["parts"].([]any)
+			for _, p := range parts {
+				if part, ok := p.(map[string]any); ok && part["functionCall"] != nil {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+func firstCandidate(m map[string]any) map[string]any {
+	candidates, ok := m["candidates"].([]any)
+	if !ok || len(candidates) == 0 {
+		return nil
+	}
+	candidate, _ := candidates[0].(map[string]any)
+	return candidate
+}
@@ -0,0 +1,101 @@
+package llm
+
+import "strings"
+
+// collections are path segments followed by a resource ID or name, such as
+// a model, file or batch, which Route replaces with a placeholder
+var collections = map[string]bool{
+	"models":         true,
+	"tunedModels":    true,
+	"files":          true,
+	"uploads":        true,
+	"batches":        true,
+	"cachedContents": true,
+	"corpora":        true,
+	"documents":      true,
+	"chunks":         true,
+	"operations":     true,
+	"permissions":    true,
+	"responses":      true,
+	"completions":    true,
+}
+
+// otherRoute names requests to paths outside the known API routes
+const otherRoute = "other"
+
+// knownRoutes are the routes of the supported APIs, as Route normalizes
+// them. Anything else is "other", so unknown paths cannot create metric
+// series.
+var knownRoutes = buildRoutes()
+
+func buildRoutes() map[string]bool {
+	routes := map[string]bool{}
+	add := func(paths ...string) {
+		for _, path := range paths {
+			routes[path] = true
+		}
+	}
+
+	// Claude
+	add("/v1/messages", "/v1/messages/count_tokens", "/v1/complete",
+		"/v1/messages/batches", "/v1/messages/batches/{id}",
+		"/v1/messages/batches/{id}/results", "/v1/messages/batches/{id}/cancel")
+
+	// OpenAI (models and files are shared with Claude)
+	add("/v1/chat/completions", "/v1/chat/completions/{id}", "/v1/completions",
+		"/v1/embeddings", "/v1/moderations", "/v1/models", "/v1/models/{id}",
+		"/v1/responses", "/v1/responses/{id}", "/v1/responses/{id}/input_items", "/v1/responses/{id}/cancel",
+		"/v1/audio/speech", "/v1/audio/transcriptions", "/v1/audio/translations",
+		"/v1/images/generations", "/v1/images/edits", "/v1/images/variations",
+		"/v1/files", "/v1/files/{id}", "/v1/files/{id}/content",
+		"/v1/uploads", "/v1/uploads/{id}/parts", "/v1/uploads/{id}/complete", "/v1/uploads/{id}/cancel",
+		"/v1/batches", "/v1/batches/{id}", "/v1/batches/{id}/cancel", "/v1/realtime")
+
+	// Gemini
+	modelMethods := []string{"generateContent", "streamGenerateContent", "countTokens",
+		"embedContent", "batchEmbedContents", "batchGenerateContent", "predict", "predictLongRunning"}
+	for _, version := range []string{"v1", "v1beta", "v1alpha"} {
+		v := "/" + version
+		add(v+"/models", v+"/models/{id}", v+"/tunedModels", v+"/tunedModels/{id}",
+			v+"/tunedModels/{id}/operations", v+"/tunedModels/{id}/operations/{id}",
+			v+"/tunedModels/{id}/permissions", v+"/tunedModels/{id}/permissions/{id}",
+			v+"/files", v+"/files/{id}", "/upload"+v+"/files",
+			v+"/cachedContents", v+"/cachedContents/{id}",
+			v+"/corpora", v+"/corpora/{id}", v+"/corpora/{id}:query",
+			v+"/corpora/{id}/documents", v+"/corpora/{id}/documents/{id}", v+"/corpora/{id}/documents/{id}:query",
+			v+"/corpora/{id}/documents/{id}/chunks", v+"/corpora/{id}/documents/{id}/chunks/{id}",
+			v+"/batches", v+"/batches/{id}", v+"/batches/{id}:cancel", v+"/operations", v+"/operations/{id}",
+			"/ws/google.ai.generativelanguage."+version+".GenerativeService.BidiGenerateContent")
+		for _, method := range modelMethods {
+			add(v+"/models/{id}:"+method, v+"/tunedModels/{id}:"+method)
+		}
+	}
+	return routes
+}
+
+// Route reduces a request path to its route, replacing resource IDs so
+// metric labels and span names have a bounded number of values. Paths that
+// are not routes of a supported API become "other".
+//
+//	/v1beta/models/gemini-2.5-pro:generateContent -> /v1beta/models/{id}:generateContent
+//	/v1/files/file-abc123/content                 -> /v1/files/{id}/content
+//	/v1/messagesfoo                               -> other
+func Route(path string) string {
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		if !collections[segments[i-1]] || segments[i] == "" || collections[segments[i]] {
+			continue
+		}
+		// Keep Gemini's ":method" suffix
+		_, method, found := strings.Cut(segments[i], ":")
+		segments[i] = "{id}"
+		if found {
+			segments[i] += ":" + method
+		}
+	}
+	route := strings.Join(segments, "/")
+	if !knownRoutes[route] {
+		return otherRoute
+	}
+	return route
+}
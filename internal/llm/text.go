@@ -0,0 +1,162 @@
+package llm
+
+import "strings"
+
+// Prompt returns the text of the latest user input in a request body: the
+// last user message of a conversation, or the prompt or input of completion
+// and embedding requests. Non-text content is skipped.
+func Prompt(provider string, body any) string {
+	m, ok := body.(map[string]any)
+	if !ok {
+		return ""
+	}
+
+	switch provider {
+	case "gemini":
+		return lastUserText(m["contents"], "parts")
+	default:
+		if text := lastUserText(m["messages"], "content"); text != "" {
+			return text
+		}
+		// Responses API input, legacy completion prompt, embedding input
+		for _, key := range []string{"input", "prompt"} {
+			if text := contentText(m[key]); text != "" {
+				return text
+			}
+			if text := lastUserText(m[key], "content"); text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// lastUserText returns the text of the last user turn in a list of
+// messages, reading each message's content from the given field
+func lastUserText(messages any, field string) string {
+	list, ok := messages.([]any)
+	if !ok {
+		return ""
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		msg, ok := list[i].(map[string]any)
+		if !ok {
+			continue
+		}
+		// Gemini may omit the role of user turns
+		if role, _ := msg["role"].(string); role != "user" && role != "" {
+			continue
+		}
+		if text := contentText(msg[field]); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// contentText flattens message content: a string, or a list of parts whose
+// text fields are joined
+func contentText(content any) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []any:
+		var texts []string
+		for _, part := range c {
+			if p, ok := part.(map[string]any); ok {
+				if text, ok := p["text"].(string); ok && text != "" {
+					texts = append(texts, text)
+				}
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+// Completion returns the generated text of a response body. Streamed
+// bodies are reassembled first.
+func Completion(provider string, body any, streaming bool) string {
+	if final := Reassemble(provider, body, streaming); final != nil {
+		return responseText(provider, final)
+	}
+	m, ok := body.(map[string]any)
+	if !ok {
+		return ""
+	}
+	return responseText(provider, m)
+}
+
+// responseText reads the text of a complete response object
+func responseText(provider string, m map[string]any) string {
+	switch provider {
+	case "claude":
+		return contentText(m["content"])
+	case "openai":
+		if text, ok := m["output_text"].(string); ok {
+			return text
+		}
+		if choice := firstChoice(m); choice != nil {
+			if msg, ok := choice["message"].(map[string]any); ok {
+				return contentText(msg["content"])
+			}
+			text, _ := choice["text"].(string)
+			return text
+		}
+		// Responses API: message items in the output list
+		var texts []string
+		if output, ok := m["output"].([]any); ok {
+			for _, item := range output {
+				if it, ok := item.(map[string]any); ok && it["type"] == "message" {
+					texts = append(texts, contentText(it["content"]))
+				}
+			}
+		}
+		return strings.Join(texts, "\n")
+	case "gemini":
+		return geminiText(m)
+	}
+	return ""
+}
+
+func firstChoice(m map[string]any) map[string]any {
+	choices, ok := m["choices"].([]any)
+	if !ok || len(choices) == 0 {
+		return nil
+	}
+	choice, _ := choices[0].(map[string]any)
+	return choice
+}
+
+// geminiText reads the text parts of the first candidate
+func geminiText(m map[string]any) string {
+	candidate := firstCandidate(m)
+	if candidate == nil {
+		return ""
+	}
+	content, ok := candidate["content"].(map[string]any)
+	if !ok {
+		return ""
+	}
+	return strings.Join(textParts(content["parts"]), "")
+}
+
+func textParts(parts any) []string {
+	list, ok := parts.([]any)
+	if !ok {
+		return nil
+	}
+	var texts []string
+	for _, part := range list {
+		if p, ok := part.(map[string]any); ok {
+			// Skip thought summaries
+			if thought, _ := p["thought"].(bool); thought {
+				continue
+			}
+			if text, ok := p["text"].(string); ok {
+				texts = append(texts, text)
+			}
+		}
+	}
+	return texts
+}
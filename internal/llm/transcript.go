@@ -0,0 +1,420 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Turn is one message of a conversation, in a form shared by all providers
+type Turn struct {
+	Role   string  `json:"role"` // system, user, assistant or tool
+	Blocks []Block `json:"blocks"`
+}
+
+// Block is one piece of a turn's content
+type Block struct {
+	Kind BlockKind `json:"kind"`
+	// Text is the text, thinking, tool result output or placeholder
+	// description
+	Text string `json:"text,omitempty"`
+	// Name and ID identify the tool of a tool call or result
+	Name string `json:"name,omitempty"`
+	ID   string `json:"id,omitempty"`
+	// Input holds a tool call's arguments, decoded from JSON when possible
+	Input any `json:"input,omitempty"`
+	// Error marks a tool result the tool reported as failed
+	Error bool `json:"error,omitempty"`
+}
+
+type BlockKind string
+
+const (
+	BlockText       BlockKind = "text"
+	BlockThinking   BlockKind = "thinking"
+	BlockToolCall   BlockKind = "tool_call"
+	BlockToolResult BlockKind = "tool_result"
+	// BlockPlaceholder stands in for images, audio, files and other content
+	// that has no text form
+	BlockPlaceholder BlockKind = "placeholder"
+)
+
+// RequestTurns returns the conversation sent in a request body: the system
+// prompt followed by the messages, or the prompt or input of completion and
+// embedding requests
+func RequestTurns(provider string, body any) []Turn {
+	m, ok := body.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	switch provider {
+	case "claude":
+		var turns []Turn
+		if system := claudeBlocks(m["system"]); len(system) > 0 {
+			turns = append(turns, Turn{Role: "system", Blocks: system})
+		}
+		for _, msg := range objects(m["messages"]) {
+			role, _ := msg["role"].(string)
+			turns = append(turns, Turn{Role: role, Blocks: claudeBlocks(msg["content"])})
+		}
+		return turns
+	case "openai":
+		return openaiRequestTurns(m)
+	case "gemini":
+		var turns []Turn
+		system, ok := m["systemInstruction"].(map[string]any)
+		if !ok {
+			system, ok = m["system_instruction"].(map[string]any)
+		}
+		if ok {
+			turns = append(turns, Turn{Role: "system", Blocks: geminiBlocks(system["parts"])})
+		}
+		for _, content := range objects(m["contents"]) {
+			turns = append(turns, Turn{Role: geminiRole(content["role"]), Blocks: geminiBlocks(content["parts"])})
+		}
+		return turns
+	}
+	return nil
+}
+
+// ResponseTurns returns the completion in a complete (or reassembled)
+// response body
+func ResponseTurns(provider string, response any) []Turn {
+	m, ok := response.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	switch provider {
+	case "claude":
+		if _, ok := m["content"]; !ok {
+			return nil
+		}
+		return []Turn{{Role: "assistant", Blocks: claudeBlocks(m["content"])}}
+	case "openai":
+		if output, ok := m["output"].([]any); ok {
+			return responsesTurns(output, "assistant")
+		}
+		if data, ok := m["data"].([]any); ok {
+			return []Turn{{Role: "assistant", Blocks: []Block{placeholder(fmt.Sprintf("%d embedding(s)", len(data)))}}}
+		}
+		choice := firstChoice(m)
+		if choice == nil {
+			return nil
+		}
+		if text, ok := choice["text"].(string); ok {
+			return []Turn{{Role: "assistant", Blocks: []Block{{Kind: BlockText, Text: text}}}}
+		}
+		msg, _ := choice["message"].(map[string]any)
+		turn := openaiMessageTurn(msg)
+		turn.Role = "assistant"
+		return []Turn{turn}
+	case "gemini":
+		if candidate := firstCandidate(m); candidate != nil {
+			content, _ := candidate["content"].(map[string]any)
+			return []Turn{{Role: "assistant", Blocks: geminiBlocks(content["parts"])}}
+		}
+		if m["embedding"] != nil || m["embeddings"] != nil {
+			return []Turn{{Role: "assistant", Blocks: []Block{placeholder("embedding")}}}
+		}
+	}
+	return nil
+}
+
+// claudeBlocks converts Claude message content: a string or a list of
+// content blocks
+func claudeBlocks(content any) []Block {
+	if s, ok := content.(string); ok {
+		if s == "" {
+			return nil
+		}
+		return []Block{{Kind: BlockText, Text: s}}
+	}
+
+	var blocks []Block
+	for _, b := range objects(content) {
+		typ, _ := b["type"].(string)
+		switch typ {
+		case "text":
+			text, _ := b["text"].(string)
+			blocks = append(blocks, Block{Kind: BlockText, Text: text})
+		case "thinking":
+			text, _ := b["thinking"].(string)
+			blocks = append(blocks, Block{Kind: BlockThinking, Text: text})
+		case "redacted_thinking":
+			blocks = append(blocks, placeholder("redacted thinking"))
+		case "tool_use", "server_tool_use":
+			name, _ := b["name"].(string)
+			id, _ := b["id"].(string)
+			blocks = append(blocks, Block{Kind: BlockToolCall, Name: name, ID: id, Input: b["input"]})
+		case "tool_result", "web_search_tool_result":
+			id, _ := b["tool_use_id"].(string)
+			isError, _ := b["is_error"].(bool)
+			blocks = append(blocks, Block{Kind: BlockToolResult, ID: id, Text: blocksText(claudeBlocks(b["content"])), Error: isError})
+		case "image", "document":
+			source, _ := b["source"].(map[string]any)
+			if mediaType, ok := source["media_type"].(string); ok {
+				typ += ": " + mediaType
+			}
+			blocks = append(blocks, placeholder(typ))
+		default:
+			blocks = append(blocks, placeholder(typ))
+		}
+	}
+	return blocks
+}
+
+func openaiRequestTurns(m map[string]any) []Turn {
+	if messages, ok := m["messages"].([]any); ok {
+		var turns []Turn
+		for _, msg := range messages {
+			if msg, ok := msg.(map[string]any); ok {
+				turns = append(turns, openaiMessageTurn(msg))
+			}
+		}
+		return turns
+	}
+
+	var turns []Turn
+	if instructions, ok := m["instructions"].(string); ok && instructions != "" {
+		turns = append(turns, Turn{Role: "system", Blocks: []Block{{Kind: BlockText, Text: instructions}}})
+	}
+	switch input := m["input"].(type) {
+	case string:
+		return append(turns, Turn{Role: "user", Blocks: []Block{{Kind: BlockText, Text: input}}})
+	case []any:
+		// The Responses API takes a list of items, embeddings a list of
+		// strings or token arrays
+		if len(objects(input)) > 0 {
+			return append(turns, responsesTurns(input, "user")...)
+		}
+		var blocks []Block
+		for _, v := range input {
+			blocks = append(blocks, Block{Kind: BlockText, Text: jsonText(v)})
+		}
+		return append(turns, Turn{Role: "user", Blocks: blocks})
+	}
+	if prompt, ok := m["prompt"]; ok {
+		return append(turns, Turn{Role: "user", Blocks: []Block{{Kind: BlockText, Text: jsonText(prompt)}}})
+	}
+	return turns
+}
+
+// openaiMessageTurn converts a chat completion message, including its tool
+// calls, or a tool message carrying a tool result
+func openaiMessageTurn(msg map[string]any) Turn {
+	role, _ := msg["role"].(string)
+	if role == "tool" || role == "function" {
+		id, _ := msg["tool_call_id"].(string)
+		name, _ := msg["name"].(string)
+		return Turn{Role: "tool", Blocks: []Block{{
+			Kind: BlockToolResult,
+			ID:   id,
+			Name: name,
+			Text: blocksText(openaiParts(msg["content"])),
+		}}}
+	}
+
+	blocks := openaiParts(msg["content"])
+	if refusal, ok := msg["refusal"].(string); ok && refusal != "" {
+		blocks = append(blocks, Block{Kind: BlockText, Text: refusal})
+	}
+	for _, call := range objects(msg["tool_calls"]) {
+		id, _ := call["id"].(string)
+		fn, _ := call["function"].(map[string]any)
+		name, _ := fn["name"].(string)
+		blocks = append(blocks, Block{Kind: BlockToolCall, Name: name, ID: id, Input: decodeArguments(fn["arguments"])})
+	}
+	if fn, ok := msg["function_call"].(map[string]any); ok {
+		name, _ := fn["name"].(string)
+		blocks = append(blocks, Block{Kind: BlockToolCall, Name: name, Input: decodeArguments(fn["arguments"])})
+	}
+	return Turn{Role: role, Blocks: blocks}
+}
+
+// openaiParts converts message content: a string or a list of content parts
+func openaiParts(content any) []Block {
+	if s, ok := content.(string); ok {
+		if s == "" {
+			return nil
+		}
+		return []Block{{Kind: BlockText, Text: s}}
+	}
+
+	var blocks []Block
+	for _, part := range objects(content) {
+		typ, _ := part["type"].(string)
+		switch typ {
+		case "text", "input_text", "output_text":
+			text, _ := part["text"].(string)
+			blocks = append(blocks, Block{Kind: BlockText, Text: text})
+		case "refusal":
+			text, _ := part["refusal"].(string)
+			blocks = append(blocks, Block{Kind: BlockText, Text: text})
+		case "image_url", "input_image":
+			blocks = append(blocks, placeholder("image"))
+		case "input_audio":
+			blocks = append(blocks, placeholder("audio"))
+		case "file", "input_file":
+			blocks = append(blocks, placeholder("file"))
+		default:
+			blocks = append(blocks, placeholder(typ))
+		}
+	}
+	return blocks
+}
+
+// responsesTurns converts Responses API input or output items
+func responsesTurns(items []any, defaultRole string) []Turn {
+	var turns []Turn
+	for _, item := range objects(items) {
+		typ, _ := item["type"].(string)
+		switch typ {
+		case "message", "":
+			role, _ := item["role"].(string)
+			if role == "" {
+				role = defaultRole
+			}
+			turns = append(turns, Turn{Role: role, Blocks: openaiParts(item["content"])})
+		case "function_call":
+			name, _ := item["name"].(string)
+			id, _ := item["call_id"].(string)
+			turns = append(turns, Turn{Role: "assistant", Blocks: []Block{{
+				Kind: BlockToolCall, Name: name, ID: id, Input: decodeArguments(item["arguments"]),
+			}}})
+		case "function_call_output":
+			id, _ := item["call_id"].(string)
+			turns = append(turns, Turn{Role: "tool", Blocks: []Block{{
+				Kind: BlockToolResult, ID: id, Text: jsonText(item["output"]),
+			}}})
+		case "reasoning":
+			var blocks []Block
+			for _, summary := range objects(item["summary"]) {
+				text, _ := summary["text"].(string)
+				blocks = append(blocks, Block{Kind: BlockThinking, Text: text})
+			}
+			if len(blocks) > 0 {
+				turns = append(turns, Turn{Role: "assistant", Blocks: blocks})
+			}
+		default:
+			turns = append(turns, Turn{Role: defaultRole, Blocks: []Block{placeholder(typ)}})
+		}
+	}
+	return turns
+}
+
+// geminiBlocks converts the parts of Gemini content
+func geminiBlocks(parts any) []Block {
+	var blocks []Block
+	for _, part := range objects(parts) {
+		switch {
+		case part["text"] != nil:
+			text, _ := part["text"].(string)
+			kind := BlockText
+			if thought, _ := part["thought"].(bool); thought {
+				kind = BlockThinking
+			}
+			blocks = append(blocks, Block{Kind: kind, Text: text})
+		case part["functionCall"] != nil:
+			call, _ := part["functionCall"].(map[string]any)
+			name, _ := call["name"].(string)
+			id, _ := call["id"].(string)
+			blocks = append(blocks, Block{Kind: BlockToolCall, Name: name, ID: id, Input: call["args"]})
+		case part["functionResponse"] != nil:
+			resp, _ := part["functionResponse"].(map[string]any)
+			name, _ := resp["name"].(string)
+			id, _ := resp["id"].(string)
+			blocks = append(blocks, Block{Kind: BlockToolResult, Name: name, ID: id, Text: jsonText(resp["response"])})
+		case part["executableCode"] != nil:
+			code, _ := part["executableCode"].(map[string]any)
+			text, _ := code["code"].(string)
+			blocks = append(blocks, Block{Kind: BlockToolCall, Name: "code_execution", Input: text})
+		case part["codeExecutionResult"] != nil:
+			result, _ := part["codeExecutionResult"].(map[string]any)
+			text, _ := result["output"].(string)
+			blocks = append(blocks, Block{Kind: BlockToolResult, Name: "code_execution", Text: text})
+		case part["inlineData"] != nil:
+			data, _ := part["inlineData"].(map[string]any)
+			mimeType, _ := data["mimeType"].(string)
+			blocks = append(blocks, placeholder("inline data: "+mimeType))
+		case part["fileData"] != nil:
+			data, _ := part["fileData"].(map[string]any)
+			uri, _ := data["fileUri"].(string)
+			blocks = append(blocks, placeholder("file: "+uri))
+		default:
+			keys := make([]string, 0, len(part))
+			for k := range part {
+				keys = append(keys, k)
+			}
+			blocks = append(blocks, placeholder(strings.Join(keys, ", ")))
+		}
+	}
+	return blocks
+}
+
+func geminiRole(role any) string {
+	switch role {
+	case "model":
+		return "assistant"
+	case "function":
+		return "tool"
+	case nil, "":
+		return "user"
+	}
+	r, _ := role.(string)
+	return r
+}
+
+func placeholder(description string) Block {
+	return Block{Kind: BlockPlaceholder, Text: "[" + description + "]"}
+}
+
+// blocksText joins the text of blocks, keeping placeholders
+func blocksText(blocks []Block) string {
+	var texts []string
+	for _, b := range blocks {
+		if b.Text != "" {
+			texts = append(texts, b.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// objects returns the objects in a JSON array
+func objects(v any) []map[string]any {
+	list, _ := v.([]any)
+	var out []map[string]any
+	for _, item := range list {
+		if m, ok := item.(map[string]any); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// decodeArguments decodes tool call arguments, which OpenAI sends as a JSON
+// string, keeping the string when it isn't valid JSON
+func decodeArguments(v any) any {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	var decoded any
+	if err := json.Unmarshal([]byte(s), &decoded); err != nil {
+		return s
+	}
+	return decoded
+}
+
+// jsonText returns a string as is and other values as JSON
+func jsonText(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
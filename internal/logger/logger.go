@@ -69,7 +69,7 @@ func (h *PrettyHandler) formatRequestLog(b *strings.Builder, r slog.Record) {
 		return true
 	})
 
-	// [TIME in grey] ⛁ [ID in blue] [provider with logo] duration [status]
+	// [TIME in grey] ⛁ [ID in blue] [provider with logo] [@client] duration [status]
 
 	// Timestamp in grey
 	b.WriteString(colorGrey)
@@ -112,6 +112,15 @@ func (h *PrettyHandler) formatRequestLog(b *strings.Builder, r slog.Record) {
 		b.WriteString(" ")
 	}
 
+	// Authenticated client name
+	if client, ok := attrs["client"].(string); ok && client != "" {
+		b.WriteString(colorGrey)
+		b.WriteString("@")
+		b.WriteString(client)
+		b.WriteString(colorReset)
+		b.WriteString(" ")
+	}
+
 	// Duration (human-readable)
 	if durationMs, ok := attrs["duration_ms"].(int64); ok {
 		b.WriteString(h.formatDuration(durationMs))
@@ -148,6 +157,15 @@ func (h *PrettyHandler) formatRequestLog(b *strings.Builder, r slog.Record) {
 		b.WriteString(path)
 		b.WriteString(colorReset)
 	}
+
+	// Outcome, only present when the exchange did not complete
+	if outcome, ok := attrs["outcome"].(string); ok {
+		b.WriteString(" ")
+		b.WriteString(colorYellow)
+		b.WriteString("✕ ")
+		b.WriteString(outcome)
+		b.WriteString(colorReset)
+	}
 }
 
 // formatStandardLog formats standard log messages
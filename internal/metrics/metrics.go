@@ -0,0 +1,157 @@
+// Package metrics exposes Prometheus metrics for proxied requests and the
+// recorder. A nil *Metrics is valid and records nothing, so callers need not
+// check whether metrics are enabled.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// latencyBuckets span fast cached responses to long generations, in seconds
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// maxModels bounds the distinct values of the model label. Model names come
+// from request bodies, so without a bound any caller could create series.
+const maxModels = 100
+
+// otherModel labels requests whose model is not tracked individually
+const otherModel = "other"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	ttfb     *prometheus.HistogramVec
+
+	dropped      prometheus.Counter
+	writeLatency prometheus.Histogram
+
+	mu     sync.Mutex
+	models map[string]bool // model label values in use
+}
+
+func New() *Metrics {
+	labels := []string{"provider", "model", "path", "status"}
+
+	m := &Metrics{
+		models:   make(map[string]bool),
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mirra_requests_total",
+			Help: "Requests handled by the proxy.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mirra_request_duration_seconds",
+			Help:    "Time from receiving a request to delivering the last response byte.",
+			Buckets: latencyBuckets,
+		}, labels),
+		ttfb: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mirra_time_to_first_byte_seconds",
+			Help:    "Time from receiving a request to delivering the first response body byte.",
+			Buckets: latencyBuckets,
+		}, labels),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "mirra_recordings_dropped_total",
+			Help: "Recordings dropped because the recorder queue was full.",
+		}),
+		writeLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "mirra_recording_write_seconds",
+			Help:    "Time taken to write a recording to storage.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.requests, m.duration, m.ttfb, m.dropped, m.writeLatency,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a completed request. route must have a bounded
+// number of values, as llm.Route returns. A zero ttfb means no response body
+// was delivered, and is not observed. The model is only used as a label for
+// successful requests, as upstream has then accepted it.
+func (m *Metrics) ObserveRequest(provider, model, route string, status int, duration, ttfb time.Duration) {
+	if m == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"provider": provider,
+		"model":    m.modelLabel(model, status),
+		"path":     route,
+		"status":   strconv.Itoa(status),
+	}
+	m.requests.With(labels).Inc()
+	m.duration.With(labels).Observe(duration.Seconds())
+	if ttfb > 0 {
+		m.ttfb.With(labels).Observe(ttfb.Seconds())
+	}
+}
+
+// modelLabel returns the label value for a request's model: the model
+// itself for the first maxModels models of successful requests, otherwise
+// "other"
+func (m *Metrics) modelLabel(model string, status int) string {
+	if model == "" {
+		return ""
+	}
+	if status < 200 || status >= 400 {
+		return otherModel
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.models[model] {
+		if len(m.models) >= maxModels {
+			return otherModel
+		}
+		m.models[model] = true
+	}
+	return model
+}
+
+// ObserveQueue reports the recorder queue depth, read at scrape time
+func (m *Metrics) ObserveQueue(depth func() int) {
+	if m == nil {
+		return
+	}
+
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "mirra_recorder_queue_depth",
+		Help: "Recordings waiting to be written.",
+	}, func() float64 {
+		return float64(depth())
+	}))
+}
+
+// RecordingDropped counts a recording dropped because the queue was full
+func (m *Metrics) RecordingDropped() {
+	if m == nil {
+		return
+	}
+	m.dropped.Inc()
+}
+
+// ObserveWrite records how long writing one recording took
+func (m *Metrics) ObserveWrite(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.writeLatency.Observe(d.Seconds())
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/llmite-ai/mirra/internal/recorder"
+)
+
+// maxInlinePart is the largest multipart text field stored in the recording
+// itself rather than in a blob
+const maxInlinePart = 64 << 10
+
+// captureRequestBody stores a request body that fit in memory on the
+// recording. JSON and text bodies are decoded right away, as rewrites,
+// caching and rate limits need them. Multipart and binary bodies are left to
+// storeRequestBody, reported by returning true, so splitting parts and
+// writing blobs stays off the request path.
+func captureRequestBody(req *recorder.RequestData, contentType string, data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if (strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "") || isBinary(mediaType, data) {
+		return true
+	}
+
+	req.Body = requestBody(data)
+	return false
+}
+
+// storeRequestBody stores a body captureRequestBody left alone: multipart
+// bodies as parts, binary payloads as a blob. It runs on the recorder's
+// worker.
+func (p *Proxy) storeRequestBody(req *recorder.RequestData, contentType string, data []byte) {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		parts, err := p.multipartParts(data, params["boundary"])
+		if err == nil {
+			req.Parts = parts
+			return
+		}
+		slog.Warn("failed to parse multipart body", "error", err)
+	}
+
+	if isBinary(mediaType, data) {
+		req.Body, req.BodyFile = p.storeBinary(data)
+		req.BodySize = int64(len(data))
+		return
+	}
+
+	req.Body = requestBody(data)
+}
+
+// multipartParts splits a multipart body into parts. Small text fields are
+// kept inline; files and other payloads are stored as blobs.
+func (p *Proxy) multipartParts(data []byte, boundary string) ([]recorder.Part, error) {
+	mr := multipart.NewReader(bytes.NewReader(data), boundary)
+
+	var parts []recorder.Part
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+
+		rp := recorder.Part{
+			Name:        part.FormName(),
+			Filename:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+			Size:        int64(len(content)),
+		}
+		mediaType, _, _ := mime.ParseMediaType(rp.ContentType)
+		if rp.Filename == "" && len(content) <= maxInlinePart && !isBinary(mediaType, content) {
+			rp.Value = string(content)
+		} else if file, err := p.recorder.WriteBlob(content); err != nil {
+			slog.Error("failed to store multipart part", "error", err, "part", rp.Name)
+		} else {
+			rp.BodyFile = file
+		}
+		parts = append(parts, rp)
+	}
+}
+
+// storeBinary stores a binary body as a blob, returning its path. If the
+// blob can't be written the body is returned base64-encoded instead.
+func (p *Proxy) storeBinary(data []byte) (any, string) {
+	file, err := p.recorder.WriteBlob(data)
+	if err != nil {
+		slog.Error("failed to store binary body", "error", err)
+		return "base64:" + base64.StdEncoding.EncodeToString(data), ""
+	}
+	return nil, file
+}
+
+// isBinary reports whether a body is binary data, such as audio or an image,
+// rather than text
+func isBinary(mediaType string, data []byte) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "json"),
+		mediaType == "application/x-www-form-urlencoded":
+		return false
+	case strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "video/"),
+		mediaType == "application/octet-stream",
+		mediaType == "application/pdf":
+		return true
+	}
+	return !utf8.Valid(data)
+}
+
+// multipartValue returns the value of the named text field of a multipart
+// body, without storing any of its parts
+func multipartValue(contentType string, data []byte, name string) string {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return ""
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(data), params["boundary"])
+	for {
+		part, err := mr.NextRawPart()
+		if err != nil {
+			return ""
+		}
+		if part.FormName() != name || part.FileName() != "" {
+			continue
+		}
+		value, err := io.ReadAll(io.LimitReader(part, maxInlinePart))
+		if err != nil {
+			return ""
+		}
+		return string(value)
+	}
+}
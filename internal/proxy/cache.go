@@ -0,0 +1,481 @@
+package proxy
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llmite-ai/mirra/internal/config"
+)
+
+// cacheHeader lets clients opt in ("on") or out ("off") of the response
+// cache per request. It is consumed by MIRRA and not forwarded upstream.
+const cacheHeader = "X-Mirra-Cache"
+
+// cacheKeyHeaders are request headers that change the meaning of an
+// otherwise identical request body, so they are part of the cache key.
+var cacheKeyHeaders = []string{"Anthropic-Version", "Anthropic-Beta", "Openai-Beta"}
+
+// cacheEntry is a complete upstream response that can be replayed verbatim
+type cacheEntry struct {
+	Status    int                 `json:"status"`
+	Headers   map[string][]string `json:"headers"`
+	Body      []byte              `json:"body"`
+	Streaming bool                `json:"streaming"`
+	StoredAt  time.Time           `json:"stored_at"`
+}
+
+func (e *cacheEntry) size() int64 {
+	return int64(len(e.Body))
+}
+
+type cacheStore interface {
+	get(key string) (*cacheEntry, bool)
+	set(key string, entry *cacheEntry)
+	remove(key string)
+	// expire removes the entries stored before cutoff
+	expire(cutoff time.Time)
+}
+
+// cacheSweepInterval is how often expired entries that are never looked up
+// again are removed
+const cacheSweepInterval = time.Minute
+
+// responseCache serves identical deterministic requests from a local store
+type responseCache struct {
+	ttl   time.Duration
+	store cacheStore
+
+	mu    sync.Mutex
+	swept time.Time // when expired entries were last removed
+}
+
+func newResponseCache(cfg config.CacheConfig) (*responseCache, error) {
+	ttl := time.Duration(cfg.TTLSeconds) * time.Second
+
+	var store cacheStore
+	switch cfg.Backend {
+	case "disk":
+		disk, err := newDiskCache(cfg.Path, cfg.MaxEntries, cfg.MaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		store = disk
+	case "memory", "":
+		store = newMemoryCache(cfg.MaxEntries, cfg.MaxBytes)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+
+	c := &responseCache{ttl: ttl, store: store}
+	// Entries left on disk by an earlier run may have expired since
+	c.sweep(time.Now())
+	return c, nil
+}
+
+// cacheable reports whether a request may be answered from the cache. Only
+// deterministic requests qualify: temperature 0, or an explicit opt-in via
+// the X-Mirra-Cache header.
+func cacheable(r *http.Request, body any) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+
+	switch strings.ToLower(r.Header.Get(cacheHeader)) {
+	case "on":
+		return body != nil
+	case "off":
+		return false
+	}
+
+	m, ok := body.(map[string]any)
+	if !ok {
+		return false
+	}
+
+	temperature, ok := m["temperature"].(json.Number)
+	if !ok {
+		// Gemini nests sampling parameters under generationConfig
+		if gen, isMap := m["generationConfig"].(map[string]any); isMap {
+			temperature, ok = gen["temperature"].(json.Number)
+		}
+	}
+	if !ok {
+		return false
+	}
+	value, err := temperature.Float64()
+	return err == nil && value == 0
+}
+
+// cacheCredentialHeaders and cacheCredentialParams carry the caller's API
+// key. They are hashed into the cache key so one caller's responses are
+// never served to another.
+var (
+	cacheCredentialHeaders = []string{"Authorization", "X-Api-Key", "X-Goog-Api-Key"}
+	cacheCredentialParams  = []string{"key", "apiKey", "api_key", "token", "access_token"}
+)
+
+// hasCredentials reports whether a request carries an API key. Requests
+// without one are never answered from the cache, since upstream would have
+// rejected them.
+func hasCredentials(header http.Header, query url.Values) bool {
+	for _, name := range cacheCredentialHeaders {
+		if header.Get(name) != "" {
+			return true
+		}
+	}
+	for _, param := range cacheCredentialParams {
+		if query.Get(param) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheKey hashes the provider, client, credentials, path, query, semantic
+// headers and canonicalized body of the request as forwarded upstream.
+// Re-marshaling the decoded body sorts object keys, so formatting and key
+// order differences do not matter.
+func cacheKey(provider, client, method, path string, query url.Values, header http.Header, body any) (string, error) {
+	canonical, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	// Credentials are hashed separately so the query part stays stable
+	credentials := sha256.New()
+	for _, name := range cacheCredentialHeaders {
+		fmt.Fprintf(credentials, "%s: %s\n", name, strings.Join(header.Values(name), ","))
+	}
+	for _, param := range cacheCredentialParams {
+		fmt.Fprintf(credentials, "%s=%s\n", param, strings.Join(query[param], ","))
+		query.Del(param)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%x\n%s\n%s\n%s\n", provider, client, credentials.Sum(nil), method, path, query.Encode())
+	for _, name := range cacheKeyHeaders {
+		fmt.Fprintf(h, "%s: %s\n", name, strings.Join(header.Values(name), ","))
+	}
+	h.Write(canonical)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *responseCache) get(key string) (*cacheEntry, bool) {
+	entry, ok := c.store.get(key)
+	if !ok {
+		return nil, false
+	}
+	if c.ttl > 0 && time.Since(entry.StoredAt) > c.ttl {
+		c.store.remove(key)
+		return nil, false
+	}
+	return entry, true
+}
+
+func (c *responseCache) set(key string, entry *cacheEntry) {
+	entry.StoredAt = time.Now()
+	c.store.set(key, entry)
+	c.sweep(entry.StoredAt)
+}
+
+// sweep removes expired entries, at most once per cacheSweepInterval
+func (c *responseCache) sweep(now time.Time) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	if now.Sub(c.swept) < cacheSweepInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.swept = now
+	c.mu.Unlock()
+
+	c.store.expire(now.Add(-c.ttl))
+}
+
+// serve replays a cached response to the client
+func (c *responseCache) serve(w http.ResponseWriter, entry *cacheEntry) error {
+	for key, values := range entry.Headers {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.Header().Set(cacheHeader, "hit")
+	w.WriteHeader(entry.Status)
+
+	_, err := w.Write(entry.Body)
+	return err
+}
+
+// memoryCache is an LRU cache bounded by entry count and total body size
+type memoryCache struct {
+	maxEntries int
+	maxBytes   int64
+
+	mu    sync.Mutex
+	bytes int64
+	order *list.List
+	items map[string]*list.Element
+}
+
+type memoryItem struct {
+	key   string
+	entry *cacheEntry
+}
+
+func newMemoryCache(maxEntries int, maxBytes int64) *memoryCache {
+	return &memoryCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (c *memoryCache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*memoryItem).entry, true
+}
+
+func (c *memoryCache) set(key string, entry *cacheEntry) {
+	if c.maxBytes > 0 && entry.size() > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.bytes -= el.Value.(*memoryItem).entry.size()
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+
+	c.items[key] = c.order.PushFront(&memoryItem{key: key, entry: entry})
+	c.bytes += entry.size()
+
+	for c.overLimit() {
+		c.removeElement(c.order.Back())
+	}
+}
+
+func (c *memoryCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *memoryCache) expire(cutoff time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, el := range c.items {
+		if el.Value.(*memoryItem).entry.StoredAt.Before(cutoff) {
+			c.removeElement(el)
+		}
+	}
+}
+
+// removeElement must be called with c.mu held
+func (c *memoryCache) removeElement(el *list.Element) {
+	item := el.Value.(*memoryItem)
+	c.order.Remove(el)
+	delete(c.items, item.key)
+	c.bytes -= item.entry.size()
+}
+
+func (c *memoryCache) overLimit() bool {
+	if c.order.Len() == 0 {
+		return false
+	}
+	return (c.maxEntries > 0 && c.order.Len() > c.maxEntries) ||
+		(c.maxBytes > 0 && c.bytes > c.maxBytes)
+}
+
+// diskCache stores one JSON file per entry, evicting the oldest entries once
+// the count or size bound is exceeded. Entries hold responses, so files are
+// only readable by the owner. The index of sizes is rebuilt from the
+// directory on startup.
+type diskCache struct {
+	dir        string
+	maxEntries int
+	maxBytes   int64
+
+	mu    sync.Mutex
+	bytes int64
+	index map[string]diskItem
+}
+
+type diskItem struct {
+	size    int64
+	modTime time.Time
+}
+
+func newDiskCache(dir string, maxEntries int, maxBytes int64) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	c := &diskCache{
+		dir:        dir,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		index:      make(map[string]diskItem),
+	}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		key := strings.TrimSuffix(filepath.Base(path), ".json")
+		c.index[key] = diskItem{size: info.Size(), modTime: info.ModTime()}
+		c.bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan cache directory: %w", err)
+	}
+
+	return c, nil
+}
+
+func (c *diskCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+func (c *diskCache) get(key string) (*cacheEntry, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		slog.Warn("discarding corrupt cache entry", "key", key, "error", err)
+		c.remove(key)
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (c *diskCache) set(key string, entry *cacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	size := int64(len(data))
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		slog.Error("failed to create cache directory", "error", err)
+		return
+	}
+
+	// Write to a temporary file first so readers never see a partial entry
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		slog.Error("failed to write cache entry", "error", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		slog.Error("failed to write cache entry", "error", err)
+		os.Remove(tmp)
+		return
+	}
+
+	if old, ok := c.index[key]; ok {
+		c.bytes -= old.size
+	}
+	c.index[key] = diskItem{size: size, modTime: time.Now()}
+	c.bytes += size
+
+	c.evict()
+}
+
+// evict removes the oldest entries until the cache is within bounds. Must
+// be called with c.mu held.
+func (c *diskCache) evict() {
+	overLimit := func() bool {
+		return (c.maxEntries > 0 && len(c.index) > c.maxEntries) ||
+			(c.maxBytes > 0 && c.bytes > c.maxBytes)
+	}
+	if !overLimit() {
+		return
+	}
+
+	keys := make([]string, 0, len(c.index))
+	for key := range c.index {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.index[keys[i]].modTime.Before(c.index[keys[j]].modTime)
+	})
+
+	for _, key := range keys {
+		if !overLimit() {
+			break
+		}
+		os.Remove(c.path(key))
+		c.bytes -= c.index[key].size
+		delete(c.index, key)
+	}
+}
+
+func (c *diskCache) expire(cutoff time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, item := range c.index {
+		if item.modTime.Before(cutoff) {
+			os.Remove(c.path(key))
+			c.bytes -= item.size
+			delete(c.index, key)
+		}
+	}
+}
+
+func (c *diskCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	os.Remove(c.path(key))
+	if item, ok := c.index[key]; ok {
+		c.bytes -= item.size
+		delete(c.index, key)
+	}
+}
@@ -0,0 +1,221 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llmite-ai/mirra/internal/auth"
+)
+
+// providerForHost returns the provider whose traffic is intercepted for host
+func (p *Proxy) providerForHost(host string) string {
+	if p.hosts == nil {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return p.hosts[strings.ToLower(host)]
+}
+
+// HandleConnect implements the CONNECT method for forward-proxy mode. TLS to
+// known LLM hosts is terminated with a certificate from the local CA and the
+// decrypted requests are routed through Handle, so they are recorded like
+// any other request. Other hosts are tunneled opaquely if allowed.
+func (p *Proxy) HandleConnect(w http.ResponseWriter, r *http.Request) {
+	if p.ca == nil {
+		http.Error(w, "forward proxy is not enabled", http.StatusMethodNotAllowed)
+		return
+	}
+
+	host := r.Host
+	if p.providerForHost(host) == "" {
+		if !p.cfg.Forward.AllowTunnel {
+			slog.Warn("refusing CONNECT to unknown host", "host", host, "remote_addr", r.RemoteAddr)
+			http.Error(w, "host is not an intercepted LLM API", http.StatusForbidden)
+			return
+		}
+		p.tunnel(w, r)
+		return
+	}
+
+	conn, err := hijack(w)
+	if err != nil {
+		slog.Error("failed to hijack CONNECT connection", "error", err)
+		return
+	}
+
+	serverName, _, err := net.SplitHostPort(host)
+	if err != nil {
+		serverName = host
+	}
+
+	tlsConn := tls.Server(conn, &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"http/1.1"},
+		// The certificate is only ever for the CONNECT target, which was
+		// checked above, so a client can't have the CA mint one for any
+		// name it sends as SNI
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "" && !strings.EqualFold(hello.ServerName, serverName) {
+				slog.Warn("refusing TLS server name that doesn't match the CONNECT host",
+					"host", host, "server_name", hello.ServerName, "remote_addr", r.RemoteAddr)
+				return nil, fmt.Errorf("server name %q does not match CONNECT host %q", hello.ServerName, serverName)
+			}
+			return p.ca.Certificate(strings.ToLower(serverName))
+		},
+	})
+
+	// Requests inside the tunnel don't carry proxy credentials, so they
+	// inherit the client identity established by the CONNECT request
+	client := auth.ClientFromContext(r.Context())
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, inner *http.Request) {
+			if inner.Host == "" {
+				inner.Host = host
+			}
+			p.Handle(w, inner)
+		}),
+		BaseContext: func(net.Listener) context.Context {
+			return auth.WithClient(context.Background(), client)
+		},
+		ReadHeaderTimeout: time.Duration(p.cfg.Timeouts.ReadHeaderSeconds) * time.Second,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelDebug),
+	}
+
+	// Serve returns once the single connection has been handled and closed
+	srv.Serve(newConnListener(tlsConn))
+}
+
+// tunnel relays bytes between the client and an arbitrary host without
+// inspecting or recording them
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := net.DialTimeout("tcp", r.Host, 30*time.Second)
+	if err != nil {
+		slog.Error("failed to dial tunnel target", "host", r.Host, "error", err)
+		http.Error(w, "failed to connect to "+r.Host, http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	conn, err := hijack(w)
+	if err != nil {
+		slog.Error("failed to hijack CONNECT connection", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	slog.Debug("tunneling connection", "host", r.Host, "remote_addr", r.RemoteAddr)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// hijack takes over the client connection and confirms the tunnel
+func hijack(w http.ResponseWriter) (net.Conn, error) {
+	conn, err := takeOver(w)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// takeOver hijacks the client connection from the HTTP server
+func takeOver(w http.ResponseWriter) (net.Conn, error) {
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	// Bytes the client sent right after the request may already be
+	// buffered; replay them before reading from the connection itself
+	if n := buf.Reader.Buffered(); n > 0 {
+		pending, _ := buf.Reader.Peek(n)
+		return &prefixConn{Conn: conn, prefix: pending}, nil
+	}
+	return conn, nil
+}
+
+type prefixConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (c *prefixConn) Read(b []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(b, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+// connListener is a net.Listener that yields a single connection, letting an
+// http.Server handle one intercepted tunnel
+type connListener struct {
+	conn      net.Conn
+	once      sync.Once
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newConnListener(conn net.Conn) *connListener {
+	return &connListener{conn: conn, closed: make(chan struct{})}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	l.once.Do(func() {
+		conn = &closeNotifyConn{Conn: l.conn, onClose: l.Close}
+	})
+	if conn != nil {
+		return conn, nil
+	}
+
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *connListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// closeNotifyConn closes its listener when the connection closes, which ends
+// the http.Server's accept loop
+type closeNotifyConn struct {
+	net.Conn
+	closeOnce sync.Once
+	onClose   func() error
+}
+
+func (c *closeNotifyConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() { c.onClose() })
+	return err
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/llmite-ai/mirra/internal/ratelimit"
+)
+
+// rateLimitBody builds a 429 error body in the shape the provider's own API
+// returns, so SDKs surface it through their native rate limit handling.
+func rateLimitBody(provider string, d ratelimit.Decision) map[string]any {
+	switch provider {
+	case "claude":
+		return map[string]any{
+			"type": "error",
+			"error": map[string]any{
+				"type":    "rate_limit_error",
+				"message": d.Message,
+			},
+		}
+	case "gemini":
+		return map[string]any{
+			"error": map[string]any{
+				"code":    http.StatusTooManyRequests,
+				"message": d.Message,
+				"status":  "RESOURCE_EXHAUSTED",
+			},
+		}
+	default:
+		return map[string]any{
+			"error": map[string]any{
+				"message": d.Message,
+				"type":    string(d.Limit),
+				"param":   nil,
+				"code":    "rate_limit_exceeded",
+			},
+		}
+	}
+}
+
+// writeRateLimited sends a provider-shaped 429 response and returns the body
+// that was written so it can be recorded.
+func writeRateLimited(w http.ResponseWriter, provider string, d ratelimit.Decision) map[string]any {
+	body := rateLimitBody(provider, d)
+
+	retryAfter := int(math.Ceil(d.RetryAfter.Seconds()))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(body)
+
+	return body
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/llmite-ai/mirra/internal/recorder"
+)
+
+// countingWriter counts the body bytes delivered to the client, notes when
+// the first of them was written, and remembers whether writing to the client
+// failed
+type countingWriter struct {
+	http.ResponseWriter
+	written    int64
+	firstWrite time.Time
+	err        error
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(b)
+	if n > 0 && c.firstWrite.IsZero() {
+		c.firstWrite = time.Now()
+	}
+	c.written += int64(n)
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+func (c *countingWriter) Flush() {
+	http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+func (c *countingWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// setOutcome classifies how relaying an exchange ended. Once the client goes
+// away the upstream request fails too, so client-side failures are checked
+// first.
+func setOutcome(rec *recorder.Recording, r *http.Request, w *countingWriter, err error) {
+	if err == nil {
+		rec.Outcome = recorder.OutcomeCompleted
+		return
+	}
+
+	rec.Error = err.Error()
+	switch {
+	case w.err != nil || errors.Is(r.Context().Err(), context.Canceled):
+		rec.Outcome = recorder.OutcomeClientCancelled
+		return
+	case isTimeout(err):
+		rec.Outcome = recorder.OutcomeTimeout
+	default:
+		rec.Outcome = recorder.OutcomeUpstreamError
+	}
+	rec.ErrorKind = errorKind(err)
+}
+
+// errorKind names the class of an upstream failure
+func errorKind(err error) string {
+	var dnsErr *net.DNSError
+	var recordErr tls.RecordHeaderError
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+
+	switch {
+	case isTimeout(err):
+		return "timeout"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.As(err, &recordErr), errors.As(err, &verifyErr), errors.As(err, &authorityErr),
+		errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return "tls"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection_reset"
+	default:
+		return "other"
+	}
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -1,42 +1,125 @@
 package proxy
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"mime"
 	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/llmite-ai/mirra/internal/auth"
+	"github.com/llmite-ai/mirra/internal/ca"
+	"github.com/llmite-ai/mirra/internal/capture"
+	"github.com/llmite-ai/mirra/internal/compression"
 	"github.com/llmite-ai/mirra/internal/config"
+	"github.com/llmite-ai/mirra/internal/llm"
+	"github.com/llmite-ai/mirra/internal/metrics"
+	"github.com/llmite-ai/mirra/internal/ratelimit"
 	"github.com/llmite-ai/mirra/internal/recorder"
+	"github.com/llmite-ai/mirra/internal/rewrite"
+	"github.com/llmite-ai/mirra/internal/tracing"
+	"github.com/llmite-ai/mirra/internal/websocket"
 )
 
 type Proxy struct {
 	cfg      *config.Config
-	client   *http.Client
+	clients  map[string]*http.Client // by provider
 	recorder *recorder.Recorder
+	limiter  *ratelimit.Limiter
+	rewriter *rewrite.Rewriter
+	cache    *responseCache
+	metrics  *metrics.Metrics
+	tracer   *tracing.Tracer
+
+	// Forward-proxy mode: CA for TLS interception and intercepted hosts
+	ca    *ca.CA
+	hosts map[string]string
 }
 
-func New(cfg *config.Config, rec *recorder.Recorder) *Proxy {
-	return &Proxy{
+// New creates the proxy. m and t may be nil. It fails if a provider's
+// egress proxy or certificates can't be loaded.
+func New(cfg *config.Config, rec *recorder.Recorder, m *metrics.Metrics, t *tracing.Tracer) (*Proxy, error) {
+	clients, err := newUpstreamClients(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proxy{
 		cfg:      cfg,
 		recorder: rec,
-		client: &http.Client{
-			Timeout: 300 * time.Second, // Longer timeout for streaming
-		},
+		metrics:  m,
+		tracer:   t,
+		limiter:  ratelimit.New(cfg.Limits),
+		rewriter: rewrite.New(cfg.Rewrites),
+		clients:  clients,
+	}
+
+	if cfg.Forward.Enabled {
+		hosts := cfg.Forward.InterceptHosts()
+		authority, created, err := ca.LoadOrGenerate(cfg.Forward.CADir, slices.Sorted(maps.Keys(hosts)))
+		if err != nil {
+			slog.Error("failed to load CA, forward proxy disabled", "error", err, "dir", cfg.Forward.CADir)
+		} else {
+			if created {
+				slog.Info("generated local CA, install it in your client trust store",
+					"cert", filepath.Join(cfg.Forward.CADir, ca.CertFileName))
+			}
+			if !authority.Constrained() {
+				slog.Warn("local CA has no name constraints and can sign for any host, replace it with mirra ca --regenerate",
+					"dir", cfg.Forward.CADir)
+			}
+			for host := range hosts {
+				if !authority.Permits(host) {
+					slog.Warn("local CA is not permitted to sign for an intercepted host, regenerate it with mirra ca --regenerate",
+						"host", host, "dir", cfg.Forward.CADir)
+				}
+			}
+			p.ca = authority
+			p.hosts = hosts
+		}
+	}
+
+	if cfg.Cache.Enabled {
+		cache, err := newResponseCache(cfg.Cache)
+		if err != nil {
+			slog.Error("failed to initialize response cache, caching disabled", "error", err)
+		} else {
+			p.cache = cache
+		}
 	}
+
+	return p, nil
 }
 
-func (p *Proxy) identifyProvider(path string) string {
+func (p *Proxy) identifyProvider(r *http.Request) string {
+	// In forward-proxy mode the target host identifies the provider
+	if provider := p.providerForHost(r.Host); provider != "" {
+		return provider
+	}
+
+	path := r.URL.Path
 	// Claude endpoints start with /v1/messages or /v1/complete
 	if strings.HasPrefix(path, "/v1/messages") || strings.HasPrefix(path, "/v1/complete") {
 		return "claude"
 	}
+	// Gemini Live API websocket, e.g.
+	// /ws/google.ai.generativelanguage.v1beta.GenerativeService.BidiGenerateContent
+	if strings.HasPrefix(path, "/ws/google.ai.generativelanguage.") {
+		return "gemini"
+	}
+	// Both APIs serve /v1/files; Gemini requests carry a Google API key
+	if strings.HasPrefix(path, "/v1/files") && !hasGeminiKey(r) {
+		return "openai"
+	}
 	// Gemini endpoints - check before OpenAI to avoid /v1/models conflict
 	if isGeminiPath(path) {
 		return "gemini"
@@ -46,12 +129,21 @@ func (p *Proxy) identifyProvider(path string) string {
 		strings.HasPrefix(path, "/v1/completions") ||
 		strings.HasPrefix(path, "/v1/embeddings") ||
 		strings.HasPrefix(path, "/v1/models") ||
-		strings.HasPrefix(path, "/v1/responses") {
+		strings.HasPrefix(path, "/v1/responses") ||
+		strings.HasPrefix(path, "/v1/realtime") ||
+		strings.HasPrefix(path, "/v1/audio/") ||
+		strings.HasPrefix(path, "/v1/images/") ||
+		strings.HasPrefix(path, "/v1/uploads") {
 		return "openai"
 	}
 	return ""
 }
 
+// hasGeminiKey reports whether a request authenticates with a Google API key
+func hasGeminiKey(r *http.Request) bool {
+	return r.Header.Get("X-Goog-Api-Key") != "" || r.URL.Query().Has("key")
+}
+
 // isGeminiPath checks if the path matches any Gemini API endpoint pattern.
 // Supports v1, v1beta, and v1alpha API versions.
 func isGeminiPath(path string) bool {
@@ -106,10 +198,11 @@ func isGeminiPath(path string) bool {
 	return false
 }
 
-func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
+func (p *Proxy) Handle(rw http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
+	w := &countingWriter{ResponseWriter: rw}
 
-	provider := p.identifyProvider(r.URL.Path)
+	provider := p.identifyProvider(r)
 	if provider == "" {
 		slog.Warn("unknown API endpoint",
 			"method", r.Method,
@@ -121,61 +214,194 @@ func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The span is ended by complete, or by fail for requests that are never
+	// recorded
+	r = p.tracer.Start(r)
+
 	providerCfg, ok := p.cfg.Providers[provider]
 	if !ok {
-		http.Error(w, fmt.Sprintf("provider %s not configured", provider), http.StatusInternalServerError)
+		p.fail(w, r, fmt.Sprintf("provider %s not configured", provider), http.StatusInternalServerError)
 		return
 	}
 
-	// Read and capture request body
-	bodyBytes, err := io.ReadAll(r.Body)
+	// Read the request body up to the in-memory cap. Larger bodies are
+	// streamed upstream and captured on the way; rewrites, caching and
+	// body-based model detection only apply to bodies under the cap.
+	maxBody := p.cfg.Recording.MaxBodyBytes
+	bodyBytes, err := readUpTo(r.Body, maxBody)
 	if err != nil {
-		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		p.fail(w, r, "failed to read request body", http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
+	bodyRead := time.Now()
+	oversized := maxBody > 0 && int64(len(bodyBytes)) > maxBody
 
 	// Create recording
 	rec := recorder.NewRecording(provider, r.Method, r.URL.Path, r.URL.RawQuery, startTime)
+	rec.Client = auth.ClientFromContext(r.Context())
+	if p.providerForHost(r.Host) != "" {
+		rec.Request.Host = r.Host
+	}
 	rec.Request.Headers = r.Header.Clone()
-	if len(bodyBytes) > 0 {
-		// Try to parse as JSON, otherwise store as string
-		var jsonBody any
-		if err := json.Unmarshal(bodyBytes, &jsonBody); err == nil {
-			rec.Request.Body = jsonBody
-		} else {
-			rec.Request.Body = string(bodyBytes)
+	delete(rec.Request.Headers, auth.HeaderName)
+	// Multipart and binary bodies are stored by the recorder's worker
+	var storeRequest func(*recorder.Recording)
+	contentType := r.Header.Get("Content-Type")
+	if !oversized && captureRequestBody(&rec.Request, contentType, bodyBytes) {
+		storeRequest = func(rec *recorder.Recording) {
+			p.storeRequestBody(&rec.Request, contentType, bodyBytes)
+		}
+	}
+	rec.Model = llm.Model(provider, r.URL.Path, rec.Request.Body)
+	if rec.Model == "" {
+		// Audio and image endpoints send the model as a form field, the
+		// Realtime API as a query parameter
+		rec.Model = multipartValue(contentType, bodyBytes, "model")
+		if rec.Model == "" {
+			rec.Model = r.URL.Query().Get("model")
 		}
 	}
 
+	// Headers meant for MIRRA only are never forwarded
+	header := r.Header.Clone()
+	header.Del(auth.HeaderName)
+	header.Del(cacheHeader)
+	if websocket.IsUpgrade(r) {
+		// Compressed frames can't be recorded, so don't let the client
+		// negotiate permessage-deflate with the upstream
+		header.Del("Sec-Websocket-Extensions")
+	}
+
+	// Apply rewrite rules; the recording keeps both the original request
+	// and what was actually sent upstream
+	out := p.rewriter.Apply(rewrite.Request{
+		Provider: provider,
+		Client:   rec.Client,
+		Path:     r.URL.Path,
+		Header:   header,
+		Body:     rec.Request.Body,
+	})
+	outBody := bodyBytes
+	if out.BodyChanged {
+		if outBody, err = json.Marshal(out.Body); err != nil {
+			p.fail(w, r, "failed to encode rewritten request body", http.StatusInternalServerError)
+			return
+		}
+		if out.Header.Get("Content-Length") != "" {
+			out.Header.Set("Content-Length", strconv.Itoa(len(outBody)))
+		}
+	}
+	if out.Changed {
+		rec.Forwarded = &recorder.RequestData{
+			Method:  r.Method,
+			Path:    out.Path,
+			Query:   r.URL.RawQuery,
+			Headers: out.Header.Clone(),
+			Body:    out.Body,
+		}
+		rec.Model = llm.Model(provider, out.Path, out.Body)
+	}
+
+	// Serve deterministic requests from the cache when possible
+	var key string
+	if p.cache != nil && cacheable(r, out.Body) && hasCredentials(out.Header, r.URL.Query()) {
+		if key, err = cacheKey(provider, rec.Client, r.Method, out.Path, r.URL.Query(), out.Header, out.Body); err != nil {
+			slog.Warn("failed to compute cache key", "error", err)
+		} else if entry, ok := p.cache.get(key); ok {
+			rec.CacheHit = true
+			rec.Response.Status = entry.Status
+			rec.Response.Headers = entry.Headers
+			rec.Response.Streaming = entry.Streaming
+			if err := p.cache.serve(w, entry); err != nil {
+				slog.Error("failed to write cached response", "error", err)
+				setOutcome(&rec, r, w, err)
+			}
+			p.complete(r, w, rec, storeRequest, func(rec *recorder.Recording) {
+				p.recordResponseBody(rec, entry.Body)
+				rec.Usage = llm.Usage(provider, rec.Response.Body, rec.Response.Streaming)
+			})
+			return
+		}
+	}
+
+	// Enforce rate limits and token budgets before touching upstream
+	limitKey := ratelimit.Key{Client: rec.Client, Provider: provider, Model: rec.Model}
+	if decision := p.limiter.Allow(limitKey); !decision.Allowed {
+		slog.Warn("rate limit exceeded",
+			"provider", provider,
+			"client", rec.Client,
+			"model", rec.Model,
+			"limit", decision.Limit)
+		rec.RateLimited = true
+		if oversized {
+			// The rest of the body was never read
+			rec.Request.Body = string(bodyBytes[:maxBody])
+			rec.Request.ExternalBody = recorder.ExternalBody{BodySize: max(r.ContentLength, 0), BodyTruncated: true}
+		}
+		rec.Response.Body = writeRateLimited(w, provider, decision)
+		rec.Response.Status = http.StatusTooManyRequests
+		rec.Response.Headers = w.Header().Clone()
+		p.complete(r, w, rec, storeRequest)
+		return
+	}
+
 	// Create upstream request
-	upstreamURL := providerCfg.UpstreamURL + r.URL.Path
+	upstreamURL := providerCfg.UpstreamURL + out.Path
 	if r.URL.RawQuery != "" {
 		upstreamURL += "?" + r.URL.RawQuery
 	}
 
-	req, err := http.NewRequestWithContext(r.Context(), r.Method, upstreamURL, bytes.NewReader(bodyBytes))
-	if err != nil {
-		http.Error(w, "failed to create upstream request", http.StatusInternalServerError)
-		return
+	var upstreamBody io.Reader = bytes.NewReader(outBody)
+	var reqCapture *capture.Buffer
+	if oversized {
+		reqCapture = capture.New(maxBody, p.spillDir())
+		upstreamBody = io.TeeReader(io.MultiReader(bytes.NewReader(bodyBytes), r.Body), reqCapture)
 	}
 
-	// Copy headers
-	for key, values := range r.Header {
-		for _, value := range values {
-			req.Header.Add(key, value)
+	trace := &upstreamTrace{}
+	req, err := http.NewRequestWithContext(trace.context(r.Context()), r.Method, upstreamURL, upstreamBody)
+	if err != nil {
+		if reqCapture != nil {
+			reqCapture.Discard()
 		}
+		p.fail(w, r, "failed to create upstream request", http.StatusInternalServerError)
+		return
+	}
+	req.Header = out.Header
+	p.tracer.Inject(r.Context(), req.Header)
+	if oversized {
+		req.ContentLength = r.ContentLength
 	}
 
 	// Make upstream request
-	resp, err := p.client.Do(req)
+	resp, err := p.clients[provider].Do(req)
+	rec.Timing.Upstream = trace.timing(bodyRead, resp)
 	if err != nil {
-		slog.Error("upstream request failed", "error", err, "provider", provider, "path", r.URL.Path)
-		http.Error(w, "upstream request failed", http.StatusBadGateway)
+		// The client sees a gateway error, and so does the recording
+		status := http.StatusBadGateway
+		if isTimeout(err) {
+			status = http.StatusGatewayTimeout
+		}
+		http.Error(w, "upstream request failed", status)
+
+		rec.Response.Status = status
+		rec.Response.Headers = w.Header().Clone()
+		rec.Response.Body = "upstream request failed"
+		setOutcome(&rec, r, w, err)
+		p.complete(r, w, rec, storeRequest, p.storeRequestCapture(reqCapture))
 		return
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		rec.Response.Status = resp.StatusCode
+		rec.Response.Headers = resp.Header.Clone()
+		p.relayWebSocket(w, r, &rec, resp)
+		p.complete(r, w, rec, storeRequest, p.storeRequestCapture(reqCapture))
+		return
+	}
+
 	// Copy response headers
 	for key, values := range resp.Header {
 		for _, value := range values {
@@ -186,21 +412,74 @@ func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
 	rec.Response.Status = resp.StatusCode
 	rec.Response.Headers = resp.Header.Clone()
 
-	// Check if streaming
-	isStreaming := strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") ||
-		strings.Contains(resp.Header.Get("Content-Type"), "stream")
+	// Check if streaming. Only SSE is relayed as a stream; other types
+	// with "stream" in the name, like application/octet-stream, are
+	// ordinary bodies.
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	isStreaming := mediaType == "text/event-stream"
 	rec.Response.Streaming = isStreaming
 
 	w.WriteHeader(resp.StatusCode)
 
+	respCapture := capture.New(maxBody, p.spillDir())
+
+	var usage *llm.UsageTracker
 	if isStreaming {
-		p.handleStreaming(w, resp.Body, &rec)
+		// Usage is read while relaying, as the stream may not fit in memory
+		usage = llm.NewUsageTracker(provider)
+		err = p.handleStreaming(w, resp.Body, io.MultiWriter(respCapture, usage))
 	} else {
-		p.handleRegular(w, resp.Body, &rec)
+		err = p.handleRegular(w, resp.Body, respCapture)
+	}
+	respCapture.Close()
+	setOutcome(&rec, r, w, err)
+	if usage != nil {
+		rec.Usage = usage.Usage()
 	}
 
+	// Decoding and storing the response waits for the recorder's worker, so
+	// the client isn't kept waiting for the end of the response
+	relayErr := err
+	p.complete(r, w, rec, storeRequest, p.storeRequestCapture(reqCapture), func(rec *recorder.Recording) {
+		defer respCapture.Discard()
+		p.recordResponseBody(rec, respCapture.Bytes())
+		if !respCapture.Complete() {
+			// Keep the blob of a complete binary body
+			rec.Response.ExternalBody = p.overflow(respCapture)
+		}
+
+		// Only complete, successful responses are worth replaying
+		if key != "" && relayErr == nil && rec.Response.Status == http.StatusOK && respCapture.Complete() {
+			p.cache.set(key, &cacheEntry{
+				Status:    rec.Response.Status,
+				Headers:   rec.Response.Headers,
+				Body:      respCapture.Bytes(),
+				Streaming: rec.Response.Streaming,
+			})
+		}
+
+		if rec.Usage == nil {
+			// Compressed streams can only be read once decoded
+			rec.Usage = llm.Usage(provider, rec.Response.Body, rec.Response.Streaming)
+		}
+		if rec.Usage != nil {
+			p.limiter.AddTokens(limitKey, rec.Usage.TotalTokens)
+		}
+	})
+}
+
+// complete finalizes timing, logs the exchange and hands it to the
+// recorder. Everything else runs on the recorder's worker, after the client
+// has been served: the process functions (nil ones are skipped) store the
+// captured bodies, then streams are reassembled and the span and metrics
+// are recorded.
+func (p *Proxy) complete(r *http.Request, w *countingWriter, rec recorder.Recording, process ...func(*recorder.Recording)) {
 	rec.Timing.CompletedAt = time.Now()
 	rec.Timing.DurationMs = rec.Timing.CompletedAt.Sub(rec.Timing.StartedAt).Milliseconds()
+	rec.BytesDelivered = w.written
+	if rec.Outcome == "" {
+		rec.Outcome = recorder.OutcomeCompleted
+	}
 
 	// Log completion
 	logLevel := slog.LevelInfo
@@ -210,86 +489,201 @@ func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
 		logLevel = slog.LevelWarn
 	}
 
-	slog.Log(r.Context(), logLevel, "request completed",
+	attrs := []any{
 		"id", rec.ID[:8],
 		"provider", rec.Provider,
+		"client", rec.Client,
 		"status", rec.Response.Status,
 		"duration_ms", rec.Timing.DurationMs,
-		"path", rec.Request.Path)
+		"path", rec.Request.Path,
+	}
+	if rec.Outcome != recorder.OutcomeCompleted {
+		logLevel = max(logLevel, slog.LevelWarn)
+		attrs = append(attrs, "outcome", rec.Outcome, "error", rec.Error)
+	}
+	slog.Log(r.Context(), logLevel, "request completed", attrs...)
 
-	// Record asynchronously
-	p.recorder.Record(rec)
+	var ttfb time.Duration
+	if !w.firstWrite.IsZero() {
+		ttfb = w.firstWrite.Sub(rec.Timing.StartedAt)
+	}
+	ctx := r.Context()
+	p.recorder.Record(rec, func(rec *recorder.Recording) {
+		for _, fn := range process {
+			if fn != nil {
+				fn(rec)
+			}
+		}
+		if final := llm.Reassemble(rec.Provider, rec.Response.Body, rec.Response.Streaming); final != nil {
+			rec.Response.Reassembled = final
+		}
+		p.tracer.Finish(ctx, rec)
+		p.metrics.ObserveRequest(rec.Provider, rec.Model, llm.Route(rec.Request.Path), rec.Response.Status,
+			rec.Timing.CompletedAt.Sub(rec.Timing.StartedAt), ttfb)
+	})
 }
 
-func (p *Proxy) handleRegular(w http.ResponseWriter, body io.Reader, rec *recorder.Recording) {
-	var buf bytes.Buffer
-	tee := io.TeeReader(body, &buf)
+// fail answers a request that couldn't be proxied and is not recorded
+func (p *Proxy) fail(w http.ResponseWriter, r *http.Request, message string, status int) {
+	http.Error(w, message, status)
+	p.tracer.End(r.Context())
+}
 
-	if _, err := io.Copy(w, tee); err != nil {
+func (p *Proxy) handleRegular(w http.ResponseWriter, body io.Reader, sink io.Writer) error {
+	if _, err := io.Copy(w, io.TeeReader(body, sink)); err != nil {
 		slog.Error("failed to copy response", "error", err)
-		return
+		return err
 	}
+	return nil
+}
 
-	if buf.Len() > 0 {
-		// Check if response is gzipped
-		isGzipped := false
-		if encodings, ok := rec.Response.Headers["Content-Encoding"]; ok {
-			for _, encoding := range encodings {
-				if strings.Contains(strings.ToLower(encoding), "gzip") {
-					isGzipped = true
-					break
-				}
+// handleStreaming relays the upstream stream to the client byte for byte,
+// flushing after every read so events are delivered as soon as they arrive.
+// The stream is never split into lines here, so arbitrarily long events pass
+// through untouched; a copy goes to sink for the recording.
+func (p *Proxy) handleStreaming(w http.ResponseWriter, body io.Reader, sink io.Writer) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		slog.Error("response writer does not support flushing")
+		return p.handleRegular(w, body, sink)
+	}
+
+	buf := make([]byte, 32*1024)
+
+	for {
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			chunk := buf[:n]
+			sink.Write(chunk)
+
+			if _, err := w.Write(chunk); err != nil {
+				slog.Error("failed to write streaming chunk", "error", err)
+				return err
 			}
+			flusher.Flush()
 		}
 
-		// Try to parse as JSON, otherwise store as string or base64
-		var jsonBody any
-		if err := json.Unmarshal(buf.Bytes(), &jsonBody); err == nil {
-			rec.Response.Body = jsonBody
-		} else if isGzipped {
-			// For gzipped content, base64 encode to preserve binary data
-			rec.Response.Body = "base64:" + base64.StdEncoding.EncodeToString(buf.Bytes())
-		} else {
-			rec.Response.Body = buf.String()
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			slog.Error("error reading stream", "error", readErr)
+			return readErr
 		}
 	}
 }
 
-func (p *Proxy) handleStreaming(w http.ResponseWriter, body io.Reader, rec *recorder.Recording) {
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		slog.Error("response writer does not support flushing")
-		io.Copy(w, body)
-		return
+// readUpTo reads the body, stopping one byte past limit so callers can tell
+// whether it fit. A limit of 0 reads everything.
+func readUpTo(body io.Reader, limit int64) ([]byte, error) {
+	if limit > 0 {
+		body = io.LimitReader(body, limit+1)
 	}
+	return io.ReadAll(body)
+}
 
-	var accumulated bytes.Buffer
-	scanner := bufio.NewScanner(body)
-	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // Support large chunks
+// spillDir is where bodies over the in-memory cap are written, or "" if they
+// are truncated instead
+func (p *Proxy) spillDir() string {
+	if p.cfg.Recording.LargeBodies != "spill" {
+		return ""
+	}
+	return p.recorder.SpillDir()
+}
 
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		accumulated.Write(line)
-		accumulated.WriteByte('\n')
+// overflow describes a captured body that exceeded the in-memory cap. A
+// spilled body is moved into the recordings blob store.
+func (p *Proxy) overflow(buf *capture.Buffer) recorder.ExternalBody {
+	if buf.Complete() {
+		return recorder.ExternalBody{}
+	}
 
-		// Write to client
-		if _, err := w.Write(line); err != nil {
-			slog.Error("failed to write streaming chunk", "error", err)
-			break
-		}
-		if _, err := w.Write([]byte("\n")); err != nil {
-			slog.Error("failed to write newline", "error", err)
-			break
+	o := recorder.ExternalBody{BodySize: buf.Size(), BodyTruncated: buf.Truncated()}
+	if !buf.Spilled() {
+		return o
+	}
+
+	tmpPath, sum := buf.SpillFile()
+	file, err := p.recorder.StoreBlob(tmpPath, sum)
+	if err != nil {
+		slog.Error("failed to store captured body", "error", err)
+		o.BodyTruncated = true
+		return o
+	}
+	o.BodyFile = file
+	return o
+}
+
+// storeRequestCapture returns the processing that stores an oversized
+// request body captured while it was streamed upstream, or nil for bodies
+// that fit in memory
+func (p *Proxy) storeRequestCapture(buf *capture.Buffer) func(*recorder.Recording) {
+	if buf == nil {
+		return nil
+	}
+	return func(rec *recorder.Recording) {
+		defer buf.Discard()
+		buf.Close()
+		rec.Request.Body = requestBody(buf.Bytes())
+		rec.Request.ExternalBody = p.overflow(buf)
+	}
+}
+
+// requestBody decodes a captured request body for the recording: JSON when
+// possible, otherwise a string. Numbers are kept as json.Number, so a body
+// re-encoded after a rewrite keeps integers too large for a float64, such as
+// seeds, exactly as the client sent them.
+func requestBody(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var jsonBody any
+	if err := dec.Decode(&jsonBody); err == nil && !dec.More() {
+		return jsonBody
+	}
+	return string(data)
+}
+
+// recordResponseBody stores a captured response body on the recording.
+// Compressed bodies are decoded first, noting the original coding in
+// content_encoding. Streaming responses are kept as SSE text; other bodies are
+// stored as JSON when possible, binary bodies as a blob, and as a plain string
+// otherwise. Bodies that can't be decoded are stored as base64.
+func (p *Proxy) recordResponseBody(rec *recorder.Recording, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	if encoding := strings.Join(rec.Response.Headers["Content-Encoding"], ","); !compression.IsIdentity(encoding) {
+		decoded, err := compression.Decode(encoding, data, p.cfg.Recording.MaxBodyBytes)
+		if err != nil {
+			slog.Warn("failed to decode response body", "encoding", encoding, "error", err)
+			rec.Response.Body = "base64:" + base64.StdEncoding.EncodeToString(data)
+			return
 		}
-		flusher.Flush()
+		data = decoded
+		rec.Response.ContentEncoding = encoding
 	}
 
-	if err := scanner.Err(); err != nil {
-		slog.Error("error reading stream", "error", err)
+	if rec.Response.Streaming {
+		rec.Response.Body = string(data)
+		return
 	}
 
-	if accumulated.Len() > 0 {
-		// Store streaming responses as string (they contain SSE format)
-		rec.Response.Body = accumulated.String()
+	// Try to parse as JSON, otherwise store as a blob if binary (e.g.
+	// generated speech) or as a string
+	var jsonBody any
+	if err := json.Unmarshal(data, &jsonBody); err == nil {
+		rec.Response.Body = jsonBody
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.Header(rec.Response.Headers).Get("Content-Type"))
+	if isBinary(mediaType, data) {
+		rec.Response.Body, rec.Response.BodyFile = p.storeBinary(data)
+		rec.Response.BodySize = int64(len(data))
+		return
 	}
+	rec.Response.Body = string(data)
 }
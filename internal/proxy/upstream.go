@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/llmite-ai/mirra/internal/config"
+	"github.com/llmite-ai/mirra/internal/recorder"
+)
+
+// newUpstreamClients builds the client used for each provider's upstream
+// requests. Providers without egress settings share one transport and its
+// connection pool. A provider whose settings can't be loaded is an error, so
+// MIRRA never starts without its configured proxy or CA.
+func newUpstreamClients(cfg *config.Config) (map[string]*http.Client, error) {
+	shared := &http.Client{Transport: newTransport(cfg)}
+
+	clients := make(map[string]*http.Client, len(cfg.Providers))
+	for name, provider := range cfg.Providers {
+		if !hasEgressSettings(provider) {
+			clients[name] = shared
+			continue
+		}
+
+		transport := newTransport(cfg)
+		if err := configureEgress(transport, provider); err != nil {
+			return nil, fmt.Errorf("provider %s: %w", name, err)
+		}
+		clients[name] = &http.Client{Transport: transport}
+	}
+	return clients, nil
+}
+
+// newTransport builds a tuned transport for upstream requests. Only the wait
+// for response headers is bounded; the body may stream for as long as the
+// upstream keeps sending, so long agentic streams are never cut off.
+func newTransport(cfg *config.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = time.Duration(cfg.Timeouts.UpstreamSeconds) * time.Second
+	transport.MaxIdleConns = cfg.Upstream.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.Upstream.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = time.Duration(cfg.Upstream.IdleConnSeconds) * time.Second
+	if !cfg.Upstream.HTTP2 {
+		// A non-nil, empty map disables HTTP/2
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
+}
+
+func hasEgressSettings(provider config.Provider) bool {
+	return provider.Proxy != "" || provider.CAFile != "" || provider.ClientCertFile != "" || provider.InsecureSkipVerify
+}
+
+// configureEgress applies a provider's egress proxy and TLS settings
+func configureEgress(transport *http.Transport, provider config.Provider) error {
+	switch provider.Proxy {
+	case "":
+		// Keep the environment proxy settings
+	case "direct":
+		transport.Proxy = nil
+	default:
+		proxyURL, err := url.Parse(provider.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: provider.InsecureSkipVerify}
+
+	if provider.CAFile != "" {
+		pem, err := os.ReadFile(provider.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA file %s", provider.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if provider.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(provider.ClientCertFile, provider.ClientKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return nil
+}
+
+// KeepWarm opens a connection to every configured upstream and refreshes it
+// before the idle timeout closes it, until ctx is cancelled
+func (p *Proxy) KeepWarm(ctx context.Context) {
+	interval := time.Duration(p.cfg.Upstream.IdleConnSeconds) * time.Second / 2
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.prewarm(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Proxy) prewarm(ctx context.Context) {
+	type target struct {
+		client *http.Client
+		url    string
+	}
+	seen := make(map[target]bool)
+	for name, provider := range p.cfg.Providers {
+		client := p.clients[name]
+		t := target{client, provider.UpstreamURL}
+		if provider.UpstreamURL == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, provider.UpstreamURL, nil)
+		if err != nil {
+			continue
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			slog.Debug("failed to prewarm upstream connection", "provider", name, "error", err)
+			continue
+		}
+		resp.Body.Close()
+	}
+}
+
+// upstreamTrace collects connection events for one upstream request. Dial
+// events may arrive from transport goroutines, hence the lock.
+type upstreamTrace struct {
+	mu           sync.Mutex
+	reused       bool
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+func (t *upstreamTrace) at(field *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if field.IsZero() {
+		*field = time.Now()
+	}
+}
+
+// context attaches the trace to ctx
+func (t *upstreamTrace) context(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { t.at(&t.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { t.at(&t.dnsDone) },
+		ConnectStart:      func(string, string) { t.at(&t.connectStart) },
+		ConnectDone:       func(string, string, error) { t.at(&t.connectDone) },
+		TLSHandshakeStart: func() { t.at(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.at(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.reused = info.Reused
+			t.mu.Unlock()
+			t.at(&t.gotConn)
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.at(&t.wroteRequest) },
+		GotFirstResponseByte: func() { t.at(&t.firstByte) },
+	})
+}
+
+// timing summarizes the trace. ready is when the proxy had read the client's
+// request body; resp may be nil if the request failed.
+func (t *upstreamTrace) timing(ready time.Time, resp *http.Response) *recorder.UpstreamTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.gotConn.IsZero() {
+		return nil
+	}
+
+	timing := &recorder.UpstreamTiming{ConnReused: t.reused}
+	if resp != nil {
+		timing.Protocol = resp.Proto
+	}
+
+	var setup time.Duration
+	for _, phase := range []struct {
+		start, done time.Time
+		ms          *int64
+	}{
+		{t.dnsStart, t.dnsDone, &timing.DNSMs},
+		{t.connectStart, t.connectDone, &timing.ConnectMs},
+		{t.tlsStart, t.tlsDone, &timing.TLSMs},
+	} {
+		if phase.start.IsZero() || phase.done.IsZero() {
+			continue
+		}
+		d := phase.done.Sub(phase.start)
+		setup += d
+		*phase.ms = d.Milliseconds()
+	}
+
+	if !t.wroteRequest.IsZero() && !t.firstByte.IsZero() {
+		timing.TTFBMs = t.firstByte.Sub(t.wroteRequest).Milliseconds()
+	}
+	timing.OverheadUs = max(t.gotConn.Sub(ready)-setup, 0).Microseconds()
+
+	return timing
+}
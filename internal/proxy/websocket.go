@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/llmite-ai/mirra/internal/recorder"
+	"github.com/llmite-ai/mirra/internal/websocket"
+)
+
+// relayWebSocket completes a WebSocket upgrade the upstream accepted, then
+// relays bytes in both directions until either side closes. Frames are
+// parsed from the relayed bytes and recorded on rec as one session.
+func (p *Proxy) relayWebSocket(w *countingWriter, r *http.Request, rec *recorder.Recording, resp *http.Response) {
+	upstream, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		http.Error(w, "upstream connection is not writable", http.StatusBadGateway)
+		rec.Response.Status = http.StatusBadGateway
+		rec.Outcome = recorder.OutcomeUpstreamError
+		rec.Error = "upstream connection is not writable"
+		return
+	}
+	defer upstream.Close()
+
+	conn, err := takeOver(w)
+	if err != nil {
+		slog.Error("failed to hijack websocket connection", "error", err)
+		rec.Outcome = recorder.OutcomeClientCancelled
+		rec.Error = err.Error()
+		return
+	}
+	defer conn.Close()
+
+	// Forward the upstream's handshake response
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "HTTP/1.1 %s\r\n", resp.Status)
+	resp.Header.Write(&head)
+	head.WriteString("\r\n")
+	if _, err := conn.Write(head.Bytes()); err != nil {
+		rec.Outcome = recorder.OutcomeClientCancelled
+		rec.Error = err.Error()
+		return
+	}
+
+	slog.Debug("websocket session started", "id", rec.ID[:8], "provider", rec.Provider, "path", rec.Request.Path)
+
+	limit := p.cfg.Recording.MaxBodyBytes
+	if limit <= 0 {
+		// Frames are held in memory until the session ends, however long
+		limit = maxWebSocketRecording
+	}
+	session := &wsSession{limit: limit}
+
+	type result struct {
+		fromClient bool
+		n          int64
+		err        error
+	}
+	results := make(chan result, 2)
+	go func() {
+		n, err := io.Copy(io.MultiWriter(upstream, session.parser("client")), conn)
+		results <- result{fromClient: true, n: n, err: err}
+	}()
+	go func() {
+		n, err := io.Copy(io.MultiWriter(conn, session.parser("server")), upstream)
+		results <- result{n: n, err: err}
+	}()
+
+	// Once either side is done, closing both connections ends the other copy
+	first := <-results
+	conn.Close()
+	upstream.Close()
+	second := <-results
+
+	for _, res := range []result{first, second} {
+		if !res.fromClient {
+			w.written += res.n
+		}
+	}
+
+	switch {
+	case first.err == nil || errors.Is(first.err, net.ErrClosed):
+		rec.Outcome = recorder.OutcomeCompleted
+	case first.fromClient:
+		rec.Outcome = recorder.OutcomeClientCancelled
+		rec.Error = first.err.Error()
+	default:
+		rec.Outcome = recorder.OutcomeUpstreamError
+		rec.Error = first.err.Error()
+		rec.ErrorKind = errorKind(first.err)
+	}
+
+	rec.Frames = session.frames
+}
+
+// maxWebSocketRecording bounds the payloads kept for a session when
+// recording.max_body_bytes doesn't
+const maxWebSocketRecording = 64 << 20
+
+// wsSession collects the messages of a WebSocket session. Payloads are
+// stored until limit bytes have been recorded; later messages keep their
+// metadata only.
+type wsSession struct {
+	mu     sync.Mutex
+	limit  int64
+	stored int64
+	frames []recorder.Frame
+}
+
+func (s *wsSession) parser(direction string) *websocket.Parser {
+	return &websocket.Parser{
+		MaxPayload: s.limit,
+		OnFrame: func(f websocket.Frame) {
+			s.add(direction, f)
+		},
+	}
+}
+
+func (s *wsSession) add(direction string, f websocket.Frame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frame := recorder.Frame{
+		Direction: direction,
+		Timestamp: time.Now(),
+		Type:      websocket.OpcodeName(f.Opcode),
+		Size:      f.Length,
+		Truncated: f.Truncated,
+	}
+	if !f.Truncated {
+		if s.stored+f.Length > s.limit {
+			frame.Truncated = true
+		} else {
+			s.stored += f.Length
+			frame.Data = frameData(f)
+		}
+	}
+	s.frames = append(s.frames, frame)
+}
+
+// frameData converts a frame payload for the recording
+func frameData(f websocket.Frame) any {
+	if len(f.Payload) == 0 {
+		return nil
+	}
+
+	switch f.Opcode {
+	case websocket.OpText:
+		var v any
+		if err := json.Unmarshal(f.Payload, &v); err == nil {
+			return v
+		}
+	case websocket.OpClose:
+		if len(f.Payload) >= 2 {
+			return map[string]any{
+				"code":   binary.BigEndian.Uint16(f.Payload),
+				"reason": string(f.Payload[2:]),
+			}
+		}
+	case websocket.OpBinary:
+		return "base64:" + base64.StdEncoding.EncodeToString(f.Payload)
+	}
+
+	if utf8.Valid(f.Payload) {
+		return string(f.Payload)
+	}
+	return "base64:" + base64.StdEncoding.EncodeToString(f.Payload)
+}
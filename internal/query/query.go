@@ -0,0 +1,546 @@
+// Package query parses and evaluates filter expressions over recordings, as
+// accepted by the --where flag of the CLI commands and the admin API:
+//
+//	status>=400 and model~"claude-*" and duration_ms>5000 and body contains "refund"
+//
+// Comparisons are joined with and, or and not, and grouped with
+// parentheses. Values are numbers, true/false, double- or single-quoted
+// strings, or bare words such as claude or 5xx. String = and != are exact
+// and case-sensitive; ~, !~ and contains ignore case.
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/llmite-ai/mirra/internal/recorder"
+)
+
+// Query is a compiled filter expression
+type Query struct {
+	source string
+	root   node
+}
+
+// Parse compiles a filter expression, checking field names and that each
+// operator suits its field
+func Parse(source string) (*Query, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.errorf(tok, "unexpected %s", tok)
+	}
+	return &Query{source: source, root: root}, nil
+}
+
+// Match reports whether a recording satisfies the query. A nil query
+// matches everything.
+func (q *Query) Match(rec *recorder.Recording) bool {
+	if q == nil {
+		return true
+	}
+	return q.root.match(&record{Recording: rec})
+}
+
+func (q *Query) String() string {
+	if q == nil {
+		return ""
+	}
+	return q.source
+}
+
+// --- Fields ---
+
+type fieldKind int
+
+const (
+	stringField fieldKind = iota
+	numberField
+	boolField
+	timeField
+	// textField holds bodies, searched with contains
+	textField
+)
+
+type field struct {
+	kind fieldKind
+	get  func(r *record) any
+}
+
+// Fields lists the field names a query may use
+func Fields() []string {
+	return []string{
+		"id", "provider", "model", "client", "method", "path", "outcome", "error", "error_kind",
+		"status", "duration_ms", "ttfb_ms", "input_tokens", "output_tokens", "total_tokens",
+		"streaming", "cache_hit", "rate_limited", "timestamp",
+		"request", "response", "body",
+	}
+}
+
+var fields = map[string]field{
+	"id":       {stringField, func(r *record) any { return r.ID }},
+	"provider": {stringField, func(r *record) any { return r.Provider }},
+	"model":    {stringField, func(r *record) any { return r.Model }},
+	"client":   {stringField, func(r *record) any { return r.Client }},
+	"method":   {stringField, func(r *record) any { return r.Request.Method }},
+	"path":     {stringField, func(r *record) any { return r.Request.Path }},
+	"outcome": {stringField, func(r *record) any {
+		// Recordings from older versions have no outcome
+		if r.Outcome == "" {
+			return recorder.OutcomeCompleted
+		}
+		return r.Outcome
+	}},
+	"error":      {stringField, func(r *record) any { return r.Error }},
+	"error_kind": {stringField, func(r *record) any { return r.ErrorKind }},
+
+	"status":      {numberField, func(r *record) any { return float64(r.Response.Status) }},
+	"duration_ms": {numberField, func(r *record) any { return float64(r.Timing.DurationMs) }},
+	"ttfb_ms": {numberField, func(r *record) any {
+		if r.Timing.Upstream == nil {
+			return float64(0)
+		}
+		return float64(r.Timing.Upstream.TTFBMs)
+	}},
+	"input_tokens":  {numberField, func(r *record) any { return float64(r.usage().InputTokens) }},
+	"output_tokens": {numberField, func(r *record) any { return float64(r.usage().OutputTokens) }},
+	"total_tokens":  {numberField, func(r *record) any { return float64(r.usage().TotalTokens) }},
+
+	"streaming":    {boolField, func(r *record) any { return r.Response.Streaming }},
+	"cache_hit":    {boolField, func(r *record) any { return r.CacheHit }},
+	"rate_limited": {boolField, func(r *record) any { return r.RateLimited }},
+
+	"timestamp": {timeField, func(r *record) any { return r.Timestamp }},
+
+	"request":  {textField, func(r *record) any { return r.requestText() }},
+	"response": {textField, func(r *record) any { return r.responseText() }},
+	"body":     {textField, func(r *record) any { return r.requestText() + "\n" + r.responseText() }},
+}
+
+// record is a recording being matched, caching the lowercased text of its
+// bodies across comparisons
+type record struct {
+	*recorder.Recording
+	request, response *string
+}
+
+func (r *record) usage() recorder.Usage {
+	if r.Usage == nil {
+		return recorder.Usage{}
+	}
+	return *r.Usage
+}
+
+func (r *record) requestText() string {
+	if r.request == nil {
+		text := strings.ToLower(bodyText(r.Request.Body))
+		r.request = &text
+	}
+	return *r.request
+}
+
+// responseText covers the reassembled response too, so text split across
+// stream events is found
+func (r *record) responseText() string {
+	if r.response == nil {
+		text := bodyText(r.Response.Body)
+		if r.Response.Reassembled != nil {
+			text += "\n" + bodyText(r.Response.Reassembled)
+		}
+		text = strings.ToLower(text)
+		r.response = &text
+	}
+	return *r.response
+}
+
+// bodyText returns a string body as is and other bodies as JSON, without
+// json.Marshal's escaping of <, > and & so they can be searched for
+func bodyText(body any) string {
+	switch b := body.(type) {
+	case nil:
+		return ""
+	case string:
+		return b
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(body); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// --- Evaluation ---
+
+type node interface {
+	match(r *record) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) match(r *record) bool { return n.left.match(r) && n.right.match(r) }
+
+type orNode struct{ left, right node }
+
+func (n orNode) match(r *record) bool { return n.left.match(r) || n.right.match(r) }
+
+type notNode struct{ node node }
+
+func (n notNode) match(r *record) bool { return !n.node.match(r) }
+
+// comparison compares a field against a value, converted when parsed to
+// the field's kind
+type comparison struct {
+	field field
+	op    string
+
+	str     string
+	pattern *regexp.Regexp // ~ and !~
+	number  float64
+	class   int // status class, e.g. 5 for 5xx; 0 when comparing a number
+	boolean bool
+	time    time.Time
+}
+
+func (c *comparison) match(r *record) bool {
+	switch v := c.field.get(r).(type) {
+	case string:
+		switch c.op {
+		case "=":
+			return v == c.str
+		case "!=":
+			return v != c.str
+		case "~":
+			return c.pattern.MatchString(v)
+		case "!~":
+			return !c.pattern.MatchString(v)
+		case "contains":
+			return strings.Contains(strings.ToLower(v), c.str)
+		}
+	case float64:
+		if c.class != 0 {
+			return (int(v)/100 == c.class) == (c.op == "=")
+		}
+		return compare(c.op, v, c.number)
+	case bool:
+		return (v == c.boolean) == (c.op == "=")
+	case time.Time:
+		return compare(c.op, float64(v.Compare(c.time)), 0)
+	}
+	return false
+}
+
+func compare(op string, a, b float64) bool {
+	switch op {
+	case "=":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+// glob compiles a pattern where * matches any run of characters and ? any
+// single character, ignoring case
+func glob(pattern string) *regexp.Regexp {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	return regexp.MustCompile("(?is)^" + expr + "$")
+}
+
+// --- Parsing ---
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorf(tok token, format string, args ...any) error {
+	return fmt.Errorf("invalid query at position %d: %s", tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	tok := p.peek()
+	switch {
+	case tok.isKeyword("not"):
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	case tok.kind == tokenLParen:
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.errorf(closing, "expected ) but found %s", closing)
+		}
+		return n, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	name := p.next()
+	if name.kind != tokenWord {
+		return nil, p.errorf(name, "expected a field name but found %s", name)
+	}
+	f, ok := fields[strings.ToLower(name.text)]
+	if !ok {
+		return nil, p.errorf(name, "unknown field %q (fields: %s)", name.text, strings.Join(Fields(), ", "))
+	}
+
+	opTok := p.next()
+	op := opTok.text
+	switch {
+	case opTok.kind == tokenOp:
+		if op == "==" {
+			op = "="
+		}
+	case opTok.isKeyword("contains"):
+		op = "contains"
+	default:
+		return nil, p.errorf(opTok, "expected an operator after %s but found %s", name.text, opTok)
+	}
+
+	valTok := p.next()
+	if valTok.kind != tokenWord && valTok.kind != tokenString {
+		return nil, p.errorf(valTok, "expected a value after %s %s but found %s", name.text, op, valTok)
+	}
+	value := valTok.text
+
+	c := &comparison{field: f, op: op}
+	invalid := func() error {
+		return p.errorf(opTok, "operator %s does not apply to %s", op, name.text)
+	}
+
+	switch f.kind {
+	case stringField:
+		switch op {
+		case "=", "!=":
+			c.str = value
+		case "~", "!~":
+			c.pattern = glob(value)
+		case "contains":
+			c.str = strings.ToLower(value)
+		default:
+			return nil, invalid()
+		}
+	case textField:
+		if op != "contains" {
+			return nil, invalid()
+		}
+		c.str = strings.ToLower(value)
+	case numberField:
+		if op == "~" || op == "!~" || op == "contains" {
+			return nil, invalid()
+		}
+		// Status classes: status=5xx
+		if len(value) == 3 && strings.EqualFold(value[1:], "xx") && value[0] >= '1' && value[0] <= '5' {
+			if op != "=" && op != "!=" {
+				return nil, p.errorf(valTok, "status classes like %s only work with = and !=", value)
+			}
+			c.class = int(value[0] - '0')
+			break
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, p.errorf(valTok, "%s needs a number, not %q", name.text, value)
+		}
+		c.number = n
+	case boolField:
+		if op != "=" && op != "!=" {
+			return nil, invalid()
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, p.errorf(valTok, "%s needs true or false, not %q", name.text, value)
+		}
+		c.boolean = b
+	case timeField:
+		switch op {
+		case "<", "<=", ">", ">=":
+		default:
+			return nil, invalid()
+		}
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339, value); err != nil {
+				return nil, p.errorf(valTok, "%s needs a YYYY-MM-DD date or RFC 3339 time, not %q", name.text, value)
+			}
+		}
+		c.time = t
+	}
+	return c, nil
+}
+
+// --- Lexing ---
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) isKeyword(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// operators, longest first so that >= is not read as >
+var operators = []string{"==", "!=", "<=", ">=", "!~", "=", "<", ">", "~"}
+
+func lex(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case c == '"' || c == '\'':
+			text, n, err := lexString(source[i:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid query at position %d: %w", i+1, err)
+			}
+			tokens = append(tokens, token{tokenString, text, i})
+			i += n
+		case strings.ContainsRune("=!<>~", rune(c)):
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(source[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("invalid query at position %d: unknown operator %q", i+1, string(c))
+			}
+			tokens = append(tokens, token{tokenOp, op, i})
+			i += len(op)
+		default:
+			start := i
+			for i < len(source) && !strings.ContainsRune(" \t\r\n()\"'=!<>~", rune(source[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokenWord, source[start:i], start})
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(source)}), nil
+}
+
+// lexString reads a quoted string, returning its value and length. Double
+// quoted strings use Go escapes; single quoted strings are taken literally.
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quote == '"' {
+				i++
+			}
+		case quote:
+			if quote == '\'' {
+				return s[1:i], i + 1, nil
+			}
+			value, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return value, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
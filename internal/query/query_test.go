@@ -0,0 +1,229 @@
+package query
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/llmite-ai/mirra/internal/recorder"
+)
+
+// testRecording is matched by the operator and precedence tests
+func testRecording() *recorder.Recording {
+	return &recorder.Recording{
+		ID:        "0f8e2c1a-7b3d-4e5f-9a6b-1c2d3e4f5a6b",
+		Timestamp: time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC),
+		Provider:  "claude",
+		Client:    "ci-bot",
+		Model:     "Claude-Sonnet-4-5",
+		Request: recorder.RequestData{
+			Method: "POST",
+			Path:   "/v1/messages",
+			Body: map[string]any{
+				"model":    "Claude-Sonnet-4-5",
+				"messages": []any{map[string]any{"role": "user", "content": "Is a<b && c>d? Ask for a REFUND"}},
+			},
+		},
+		Response: recorder.ResponseData{
+			Status:      529,
+			Streaming:   true,
+			Body:        "event: content_block_delta\ndata: {\"delta\":{\"text\":\"over\"}}\n\nevent: content_block_delta\ndata: {\"delta\":{\"text\":\"loaded\"}}\n\n",
+			Reassembled: map[string]any{"content": []any{map[string]any{"type": "text", "text": "overloaded"}}},
+		},
+		Timing: recorder.TimingData{
+			DurationMs: 6200,
+			Upstream:   &recorder.UpstreamTiming{TTFBMs: 850},
+		},
+		Usage:     &recorder.Usage{InputTokens: 120, OutputTokens: 30, TotalTokens: 150},
+		CacheHit:  true,
+		Outcome:   recorder.OutcomeUpstreamError,
+		Error:     "upstream closed the stream",
+		ErrorKind: "connection_reset",
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"", "expected a field name"},
+		{"nope=1", `unknown field "nope"`},
+		{"status", "expected an operator after status"},
+		{"status>=", "expected a value after status >="},
+		{"status=abc", `status needs a number, not "abc"`},
+		{"status>5xx", "status classes like 5xx only work with = and !="},
+		{"status~5", "operator ~ does not apply to status"},
+		{"status contains 5", "operator contains does not apply to status"},
+		{"model<a", "operator < does not apply to model"},
+		{"body=refund", "operator = does not apply to body"},
+		{"streaming>true", "operator > does not apply to streaming"},
+		{"streaming=yes", `streaming needs true or false, not "yes"`},
+		{"timestamp=2026-03-14", "operator = does not apply to timestamp"},
+		{"timestamp>yesterday", "timestamp needs a YYYY-MM-DD date or RFC 3339 time"},
+		{`model="claude`, "position 7: unterminated string"},
+		{"status=200 !", `position 12: unknown operator "!"`},
+		{"(status=200", "expected ) but found end of query"},
+		{"status=200)", `unexpected ")"`},
+		{"status=200 provider=claude", `unexpected "provider"`},
+		{"status=200 and", "expected a field name but found end of query"},
+		{"not", "expected a field name but found end of query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded, want error containing %q", tt.expr, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse(%q) error = %q, want it to contain %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// and binds tighter than or
+		{"provider=openai and status=200 or cache_hit=true", true},
+		{"cache_hit=true or provider=openai and status=200", true},
+		{"provider=openai and (status=200 or cache_hit=true)", false},
+		{"(cache_hit=true or provider=openai) and status=200", false},
+		// not binds tighter than and and or
+		{"not provider=openai and status=529", true},
+		{"not provider=claude or status=529", true},
+		{"not (provider=claude or status=200)", false},
+		{"not not provider=claude", true},
+		// Keywords ignore case
+		{"provider=claude AND NOT status=200", true},
+	}
+	rec := testRecording()
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			q, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := q.Match(rec); got != tt.want {
+				t.Errorf("%q matched %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// String = and != are exact and case-sensitive
+		{"model=Claude-Sonnet-4-5", true},
+		{"model=claude-sonnet-4-5", false},
+		{"model==Claude-Sonnet-4-5", true},
+		{"model!=claude-sonnet-4-5", true},
+		{"model!=Claude-Sonnet-4-5", false},
+		{`client="ci-bot"`, true},
+		{`client='ci-bot'`, true},
+		{"method=POST", true},
+		{"path=/v1/messages", true},
+		{"error_kind=connection_reset", true},
+		{"outcome=upstream_error", true},
+
+		// ~ and !~ are globs that ignore case
+		{`model~"claude-*"`, true},
+		{`model~"CLAUDE-SONNET-?-5"`, true},
+		{`model~"claude"`, false},
+		{`model!~"gpt-*"`, true},
+		{`model!~"*sonnet*"`, false},
+
+		// contains ignores case
+		{`error contains "CLOSED"`, true},
+		{`error contains "timeout"`, false},
+
+		// Numbers
+		{"status=529", true},
+		{"status!=529", false},
+		{"status<600", true},
+		{"status<=529", true},
+		{"status>529", false},
+		{"status>=529", true},
+		{"status=5xx", true},
+		{"status=5XX", true},
+		{"status!=5xx", false},
+		{"status=4xx", false},
+		{"duration_ms>5000", true},
+		{"ttfb_ms<1000", true},
+		{"input_tokens=120", true},
+		{"output_tokens>=30", true},
+		{"total_tokens<150", false},
+
+		// Booleans
+		{"streaming=true", true},
+		{"cache_hit!=true", false},
+		{"rate_limited=false", true},
+
+		// Timestamps
+		{"timestamp>=2026-03-14", true},
+		{"timestamp<2026-03-14", false},
+		{"timestamp<2026-03-14T15:10:00Z", true},
+		{"timestamp>2026-03-14T15:10:00Z", false},
+
+		// Bodies are searched as text that ignores case, with <, > and &
+		// unescaped
+		{`request contains "refund"`, true},
+		{`request contains "a<b && c>d"`, true},
+		{`request contains "overloaded"`, false},
+		// The reassembled response matches text split across events
+		{`response contains "OVERLOADED"`, true},
+		{`body contains "refund"`, true},
+		{`body contains "overloaded"`, true},
+		{`body contains "missing"`, false},
+	}
+	rec := testRecording()
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			q, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := q.Match(rec); got != tt.want {
+				t.Errorf("%q matched %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingValues(t *testing.T) {
+	rec := &recorder.Recording{Provider: "gemini"}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// Recordings from older versions have no outcome
+		{"outcome=completed", true},
+		{"input_tokens=0", true},
+		{"ttfb_ms=0", true},
+		{`body contains "x"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			q, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := q.Match(rec); got != tt.want {
+				t.Errorf("%q matched %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilQuery(t *testing.T) {
+	var q *Query
+	if !q.Match(testRecording()) {
+		t.Error("nil query should match everything")
+	}
+}
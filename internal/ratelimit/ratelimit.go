@@ -0,0 +1,222 @@
+// Package ratelimit enforces per-client, per-provider and per-model request
+// rates and daily token budgets. Counters are kept in memory and reset when
+// the process restarts.
+package ratelimit
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llmite-ai/mirra/internal/config"
+)
+
+// Key identifies the traffic a request belongs to
+type Key struct {
+	Client   string
+	Provider string
+	Model    string
+}
+
+// Limit names which budget rejected a request
+type Limit string
+
+const (
+	LimitRequests Limit = "requests"
+	LimitTokens   Limit = "tokens"
+)
+
+// Decision is the result of checking a request against the configured rules
+type Decision struct {
+	Allowed    bool
+	Limit      Limit
+	RetryAfter time.Duration
+	Message    string
+}
+
+type bucket struct {
+	minute   time.Time
+	requests int
+	day      time.Time
+	tokens   int64
+}
+
+type Limiter struct {
+	rules   []config.LimitRule
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	// swept is the minute idle buckets were last evicted
+	swept time.Time
+}
+
+func New(rules []config.LimitRule) *Limiter {
+	return &Limiter{
+		rules:   rules,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow checks every matching rule and, if none is exhausted, counts the
+// request against each of them.
+func (l *Limiter) Allow(k Key) Decision {
+	if len(l.rules) == 0 {
+		return Decision{Allowed: true}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now().UTC()
+	minute := now.Truncate(time.Minute)
+	day := now.Truncate(24 * time.Hour)
+	l.sweep(minute, day)
+
+	var matched []*bucket
+	for i, rule := range l.rules {
+		if !matches(rule, k) {
+			continue
+		}
+
+		b := l.bucket(i, rule, k, minute, day)
+
+		if rule.RequestsPerMinute > 0 && b.requests >= rule.RequestsPerMinute {
+			return Decision{
+				Limit:      LimitRequests,
+				RetryAfter: minute.Add(time.Minute).Sub(now),
+				Message: fmt.Sprintf("Rate limit reached for %s: %d requests per minute",
+					describe(rule, k), rule.RequestsPerMinute),
+			}
+		}
+		if rule.TokensPerDay > 0 && b.tokens >= rule.TokensPerDay {
+			return Decision{
+				Limit:      LimitTokens,
+				RetryAfter: day.Add(24 * time.Hour).Sub(now),
+				Message: fmt.Sprintf("Token budget exhausted for %s: %d of %d tokens per day used",
+					describe(rule, k), b.tokens, rule.TokensPerDay),
+			}
+		}
+
+		matched = append(matched, b)
+	}
+
+	for _, b := range matched {
+		b.requests++
+	}
+
+	return Decision{Allowed: true}
+}
+
+// AddTokens charges tokens consumed by a completed request to every matching
+// rule's daily budget.
+func (l *Limiter) AddTokens(k Key, tokens int64) {
+	if len(l.rules) == 0 || tokens <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now().UTC()
+	minute := now.Truncate(time.Minute)
+	day := now.Truncate(24 * time.Hour)
+	l.sweep(minute, day)
+
+	for i, rule := range l.rules {
+		if rule.TokensPerDay <= 0 || !matches(rule, k) {
+			continue
+		}
+		l.bucket(i, rule, k, minute, day).tokens += tokens
+	}
+}
+
+// bucket returns the counters for a rule, resetting windows that have
+// elapsed. Must be called with l.mu held.
+func (l *Limiter) bucket(idx int, rule config.LimitRule, k Key, minute, day time.Time) *bucket {
+	id := fmt.Sprintf("%d|%s|%s|%s", idx,
+		scope(rule.Client, k.Client),
+		scope(rule.Provider, k.Provider),
+		scope(rule.Model, k.Model))
+
+	b, ok := l.buckets[id]
+	if !ok {
+		b = &bucket{minute: minute, day: day}
+		l.buckets[id] = b
+	}
+	if !b.minute.Equal(minute) {
+		b.minute = minute
+		b.requests = 0
+	}
+	if !b.day.Equal(day) {
+		b.day = day
+		b.tokens = 0
+	}
+	return b
+}
+
+// sweep evicts buckets with nothing counted in the current windows, at most
+// once a minute, so "*" rules don't keep a bucket for every value ever seen.
+// An evicted bucket is recreated empty, which is what it would have been
+// reset to anyway. Must be called with l.mu held.
+func (l *Limiter) sweep(minute, day time.Time) {
+	if l.swept.Equal(minute) {
+		return
+	}
+	l.swept = minute
+	for id, b := range l.buckets {
+		if b.minute.Before(minute) && (b.tokens == 0 || b.day.Before(day)) {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+func matches(rule config.LimitRule, k Key) bool {
+	return match(rule.Client, k.Client) &&
+		match(rule.Provider, k.Provider) &&
+		match(rule.Model, k.Model)
+}
+
+func match(pattern, value string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
+
+// scope returns the part of the bucket key contributed by one dimension.
+// Only "*" tracks distinct values separately; everything else is shared.
+func scope(pattern, value string) string {
+	if pattern == "*" {
+		return value
+	}
+	return ""
+}
+
+// describe renders the scope of a rule for error messages
+func describe(rule config.LimitRule, k Key) string {
+	var parts []string
+	if rule.Client != "" {
+		parts = append(parts, "client "+scopedValue(rule.Client, k.Client))
+	}
+	if rule.Provider != "" {
+		parts = append(parts, "provider "+scopedValue(rule.Provider, k.Provider))
+	}
+	if rule.Model != "" {
+		parts = append(parts, "model "+scopedValue(rule.Model, k.Model))
+	}
+	if len(parts) == 0 {
+		return "all traffic"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func scopedValue(pattern, value string) string {
+	if pattern == "*" {
+		return value
+	}
+	return pattern
+}
@@ -1,6 +1,8 @@
 package recorder
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log/slog"
@@ -10,23 +12,77 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/llmite-ai/mirra/internal/metrics"
 )
 
 type Recording struct {
-	ID        string                 `json:"id"`
-	Timestamp time.Time              `json:"timestamp"`
-	Provider  string                 `json:"provider"`
-	Request   RequestData            `json:"request"`
-	Response  ResponseData           `json:"response"`
-	Timing    TimingData             `json:"timing"`
+	ID          string       `json:"id"`
+	Timestamp   time.Time    `json:"timestamp"`
+	Provider    string       `json:"provider"`
+	Client      string       `json:"client,omitempty"`
+	Model       string       `json:"model,omitempty"`
+	Request     RequestData  `json:"request"`
+	Forwarded   *RequestData `json:"forwarded_request,omitempty"`
+	Response    ResponseData `json:"response"`
+	Timing      TimingData   `json:"timing"`
+	Usage       *Usage       `json:"usage,omitempty"`
+	RateLimited bool         `json:"rate_limited,omitempty"`
+	CacheHit    bool         `json:"cache_hit,omitempty"`
+
+	// Outcome tells how the exchange ended; Error explains any outcome
+	// other than OutcomeCompleted. Recordings from older versions have no
+	// outcome and are treated as completed.
+	Outcome        string `json:"outcome,omitempty"`
+	Error          string `json:"error,omitempty"`
+	BytesDelivered int64  `json:"bytes_delivered"` // response body bytes written to the client
+	// ErrorKind classifies upstream failures: dns, tls, connection_refused,
+	// connection_reset, timeout or other
+	ErrorKind string `json:"error_kind,omitempty"`
+	// Frames holds the messages of a WebSocket session, in the order they
+	// were relayed
+	Frames []Frame `json:"frames,omitempty"`
+}
+
+// Frame is one WebSocket frame of a session. Text payloads are stored as
+// JSON when possible, binary payloads base64-encoded. Data is omitted once
+// the session's payload budget is spent.
+type Frame struct {
+	Direction string    `json:"direction"` // "client" or "server"
+	Timestamp time.Time `json:"timestamp"`
+	Type      string    `json:"type"` // text, binary, continuation, close, ping or pong
+	Size      int64     `json:"size"`
+	Data      any       `json:"data,omitempty"`
+	Truncated bool      `json:"truncated,omitempty"`
 }
 
+// Recording outcomes
+const (
+	OutcomeCompleted       = "completed"
+	OutcomeClientCancelled = "client_cancelled"
+	OutcomeUpstreamError   = "upstream_error"
+	OutcomeTimeout         = "timeout"
+)
+
 type RequestData struct {
+	Host    string              `json:"host,omitempty"`
 	Method  string              `json:"method"`
 	Path    string              `json:"path"`
 	Query   string              `json:"query,omitempty"`
 	Headers map[string][]string `json:"headers"`
 	Body    interface{}         `json:"body,omitempty"`
+	Parts   []Part              `json:"parts,omitempty"` // multipart bodies, in place of Body
+	ExternalBody
+}
+
+// Part is one part of a multipart request body. Small text fields are kept
+// in Value; file contents and other payloads are stored in a blob.
+type Part struct {
+	Name        string `json:"name,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Value       string `json:"value,omitempty"`
+	Size        int64  `json:"size"`
+	BodyFile    string `json:"body_file,omitempty"`
 }
 
 type ResponseData struct {
@@ -34,54 +90,153 @@ type ResponseData struct {
 	Headers   map[string][]string `json:"headers"`
 	Body      interface{}         `json:"body,omitempty"`
 	Streaming bool                `json:"streaming"`
+	// Reassembled is a streamed Body folded into the equivalent
+	// non-streaming response, e.g. a Claude Message or an OpenAI
+	// ChatCompletion
+	Reassembled any `json:"reassembled,omitempty"`
+	// ContentEncoding is the coding Body was decoded from, e.g. "gzip"
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	ExternalBody
+}
+
+// ExternalBody describes a body that is not stored inline: a binary body or
+// one over the in-memory capture cap kept in a blob file, or an oversized
+// body truncated with Body holding a prefix.
+type ExternalBody struct {
+	BodyFile      string `json:"body_file,omitempty"` // relative to the recordings directory
+	BodySize      int64  `json:"body_size,omitempty"` // original size in bytes
+	BodyTruncated bool   `json:"body_truncated,omitempty"`
 }
 
 type TimingData struct {
-	StartedAt   time.Time `json:"started_at"`
-	CompletedAt time.Time `json:"completed_at"`
-	DurationMs  int64     `json:"duration_ms"`
+	StartedAt   time.Time       `json:"started_at"`
+	CompletedAt time.Time       `json:"completed_at"`
+	DurationMs  int64           `json:"duration_ms"`
+	Upstream    *UpstreamTiming `json:"upstream,omitempty"`
+}
+
+// UpstreamTiming breaks down the upstream request. Connection setup times
+// are only present when a new connection was opened. OverheadUs is the time
+// the proxy spent before sending the request, not counting reading the
+// client's body or connecting to the upstream.
+type UpstreamTiming struct {
+	ConnReused bool   `json:"conn_reused"`
+	Protocol   string `json:"protocol,omitempty"`
+	DNSMs      int64  `json:"dns_ms,omitempty"`
+	ConnectMs  int64  `json:"connect_ms,omitempty"`
+	TLSMs      int64  `json:"tls_ms,omitempty"`
+	TTFBMs     int64  `json:"ttfb_ms"` // request sent to first response byte
+	OverheadUs int64  `json:"overhead_us"`
+}
+
+// Usage holds the token counts reported by the provider
+type Usage struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	TotalTokens  int64 `json:"total_tokens"`
 }
 
 type Recorder struct {
 	enabled    bool
 	path       string
 	mu         sync.Mutex
-	recordChan chan Recording
+	recordChan chan pending
 	stopChan   chan struct{}
 	wg         sync.WaitGroup
+	metrics    *metrics.Metrics
+
+	subMu       sync.Mutex
+	subscribers map[chan Recording]struct{}
 }
 
-func New(enabled bool, path string) *Recorder {
+// pending is a recording waiting for the worker, with the processing that
+// completes it
+type pending struct {
+	rec     Recording
+	process func(*Recording)
+}
+
+// subscriberBuffer is how many recordings a subscriber may fall behind by
+// before recordings are dropped for it
+const subscriberBuffer = 64
+
+// blobsDir holds bodies too large to inline, named by their SHA-256 digest
+const blobsDir = "blobs"
+
+// New creates a recorder writing to path. m may be nil.
+func New(enabled bool, path string, m *metrics.Metrics) *Recorder {
 	r := &Recorder{
 		enabled:    enabled,
 		path:       path,
-		recordChan: make(chan Recording, 100),
+		recordChan: make(chan pending, 100),
 		stopChan:   make(chan struct{}),
+		metrics:    m,
+
+		subscribers: make(map[chan Recording]struct{}),
 	}
+	m.ObserveQueue(func() int { return len(r.recordChan) })
 
 	if enabled {
 		if err := os.MkdirAll(path, 0755); err != nil {
 			slog.Error("failed to create recordings directory", "error", err, "path", path)
 			r.enabled = false
-			return r
 		}
-
-		r.wg.Add(1)
-		go r.worker()
 	}
 
+	// The worker runs even when recording is disabled, as subscribers and
+	// the processing passed to Record still need it
+	r.wg.Add(1)
+	go r.worker()
+
 	return r
 }
 
-func (r *Recorder) Record(rec Recording) {
-	if !r.enabled {
-		return
-	}
-
+// Record queues a finished exchange. process, which may be nil, runs on the
+// recorder's worker before the recording is published and written, for work
+// too slow for the request path such as decoding bodies and writing blobs.
+// If the queue is full the recording is processed and published right away
+// but not written.
+func (r *Recorder) Record(rec Recording, process func(*Recording)) {
 	select {
-	case r.recordChan <- rec:
+	case r.recordChan <- pending{rec: rec, process: process}:
 	default:
 		slog.Warn("recording channel full, dropping recording", "id", rec.ID)
+		r.metrics.RecordingDropped()
+		r.finish(pending{rec: rec, process: process})
+	}
+}
+
+// Subscribe returns a channel receiving every recording passed to Record,
+// whether or not recording to storage is enabled, and a function ending the
+// subscription. A subscriber that falls behind misses recordings rather than
+// slowing down the proxy.
+func (r *Recorder) Subscribe() (<-chan Recording, func()) {
+	ch := make(chan Recording, subscriberBuffer)
+
+	r.subMu.Lock()
+	r.subscribers[ch] = struct{}{}
+	r.subMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			r.subMu.Lock()
+			delete(r.subscribers, ch)
+			r.subMu.Unlock()
+		})
+	}
+}
+
+func (r *Recorder) publish(rec Recording) {
+	r.subMu.Lock()
+	defer r.subMu.Unlock()
+
+	for ch := range r.subscribers {
+		select {
+		case ch <- rec:
+		default:
+			slog.Debug("subscriber falling behind, dropping recording", "id", rec.ID)
+		}
 	}
 }
 
@@ -90,18 +245,14 @@ func (r *Recorder) worker() {
 
 	for {
 		select {
-		case rec := <-r.recordChan:
-			if err := r.writeRecording(rec); err != nil {
-				slog.Error("failed to write recording", "error", err, "id", rec.ID)
-			}
+		case p := <-r.recordChan:
+			r.write(r.finish(p))
 		case <-r.stopChan:
 			// Drain remaining recordings
 			for {
 				select {
-				case rec := <-r.recordChan:
-					if err := r.writeRecording(rec); err != nil {
-						slog.Error("failed to write recording", "error", err, "id", rec.ID)
-					}
+				case p := <-r.recordChan:
+					r.write(r.finish(p))
 				default:
 					return
 				}
@@ -110,6 +261,27 @@ func (r *Recorder) worker() {
 	}
 }
 
+// finish runs a recording's processing and publishes it to subscribers
+func (r *Recorder) finish(p pending) Recording {
+	if p.process != nil {
+		p.process(&p.rec)
+	}
+	r.publish(p.rec)
+	return p.rec
+}
+
+func (r *Recorder) write(rec Recording) {
+	if !r.enabled {
+		return
+	}
+	start := time.Now()
+	err := r.writeRecording(rec)
+	r.metrics.ObserveWrite(time.Since(start))
+	if err != nil {
+		slog.Error("failed to write recording", "error", err, "id", rec.ID)
+	}
+}
+
 func (r *Recorder) writeRecording(rec Recording) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -135,11 +307,69 @@ func (r *Recorder) writeRecording(rec Recording) error {
 	return nil
 }
 
-func (r *Recorder) Close() error {
+// SpillDir returns the directory for temporary body files, or "" when
+// recording is disabled and large bodies need not be kept
+func (r *Recorder) SpillDir() string {
 	if !r.enabled {
-		return nil
+		return ""
 	}
+	return filepath.Join(r.path, blobsDir, "tmp")
+}
+
+// StoreBlob moves a spilled body file into the content-addressed blob store
+// and returns its path relative to the recordings directory. Identical bodies
+// are stored once.
+func (r *Recorder) StoreBlob(tmpPath, sum string) (string, error) {
+	rel := filepath.Join(blobsDir, sum[:2], sum)
+	dst := filepath.Join(r.path, rel)
 
+	if _, err := os.Stat(dst); err == nil {
+		os.Remove(tmpPath)
+		return filepath.ToSlash(rel), nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		return "", fmt.Errorf("failed to store blob: %w", err)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// WriteBlob stores data in the content-addressed blob store and returns its
+// path relative to the recordings directory, or "" if recording is disabled
+func (r *Recorder) WriteBlob(data []byte) (string, error) {
+	if !r.enabled {
+		return "", nil
+	}
+
+	sum := sha256.Sum256(data)
+	tmpDir := r.SpillDir()
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	f, err := os.CreateTemp(tmpDir, "blob-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create blob: %w", err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+
+	file, err := r.StoreBlob(f.Name(), hex.EncodeToString(sum[:]))
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return file, err
+}
+
+func (r *Recorder) Close() error {
 	close(r.stopChan)
 	r.wg.Wait()
 	return nil
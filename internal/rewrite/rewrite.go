@@ -0,0 +1,230 @@
+// Package rewrite applies declarative request transforms from the config
+// before a request is forwarded upstream.
+package rewrite
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/llmite-ai/mirra/internal/config"
+)
+
+// Request is the part of a proxied request that rules can change
+type Request struct {
+	Provider string
+	Client   string
+	Path     string
+	Header   http.Header
+	// Body is the decoded JSON body, or nil if the body is not JSON. It
+	// should be decoded with json.Decoder.UseNumber, so numbers survive
+	// being re-encoded unchanged.
+	Body any
+}
+
+// Result describes what Apply changed
+type Result struct {
+	Request
+	Changed     bool
+	BodyChanged bool
+}
+
+type Rewriter struct {
+	rules []config.RewriteRule
+}
+
+func New(rules []config.RewriteRule) *Rewriter {
+	return &Rewriter{rules: rules}
+}
+
+// Apply runs every matching rule in order. The input is never modified; when
+// a rule matches, the header and body are deep-copied first.
+func (rw *Rewriter) Apply(in Request) Result {
+	res := Result{Request: in}
+	copied := false
+
+	for _, rule := range rw.rules {
+		// Match the request as earlier rules left it, e.g. a rewritten
+		// Gemini model path
+		if !matches(rule, res.Request) {
+			continue
+		}
+		if !copied {
+			res.Header = in.Header.Clone()
+			res.Body = deepCopy(in.Body)
+			copied = true
+		}
+
+		for _, name := range rule.RemoveHeaders {
+			if res.Header.Get(name) != "" {
+				res.Header.Del(name)
+				res.Changed = true
+			}
+		}
+		for name, value := range rule.SetHeaders {
+			res.Header.Set(name, value)
+			res.Changed = true
+		}
+
+		if to, ok := rule.Models[currentModel(res.Request)]; ok {
+			setModel(&res, to)
+		}
+
+		body, isMap := res.Body.(map[string]any)
+		if !isMap {
+			continue
+		}
+
+		if rule.DefaultMaxTokens > 0 && setDefaultMaxTokens(in.Provider, res.Path, body, rule.DefaultMaxTokens) {
+			res.Changed = true
+			res.BodyChanged = true
+		}
+
+		for _, field := range rule.StripFields {
+			if deleteField(body, strings.Split(field, ".")) {
+				res.Changed = true
+				res.BodyChanged = true
+			}
+		}
+	}
+
+	return res
+}
+
+func matches(rule config.RewriteRule, req Request) bool {
+	if rule.Provider != "" && rule.Provider != req.Provider {
+		return false
+	}
+	if rule.Client != "" {
+		if ok, _ := path.Match(rule.Client, req.Client); !ok {
+			return false
+		}
+	}
+	if rule.Path != "" && !strings.HasPrefix(req.Path, rule.Path) {
+		return false
+	}
+	return true
+}
+
+// currentModel returns the model a request targets. Gemini carries it in the
+// path, the other providers in the body.
+func currentModel(req Request) string {
+	if req.Provider == "gemini" {
+		_, model, _ := geminiModelSpan(req.Path)
+		return model
+	}
+	if body, ok := req.Body.(map[string]any); ok {
+		model, _ := body["model"].(string)
+		return model
+	}
+	return ""
+}
+
+func setModel(res *Result, model string) {
+	if res.Provider == "gemini" {
+		start, current, ok := geminiModelSpan(res.Path)
+		if ok {
+			res.Path = res.Path[:start] + model + res.Path[start+len(current):]
+			res.Changed = true
+		}
+		return
+	}
+	if body, ok := res.Body.(map[string]any); ok {
+		body["model"] = model
+		res.Changed = true
+		res.BodyChanged = true
+	}
+}
+
+// geminiModelSpan locates the model name in a path such as
+// /v1beta/models/gemini-2.5-pro:generateContent
+func geminiModelSpan(p string) (int, string, bool) {
+	idx := strings.Index(p, "/models/")
+	if idx < 0 {
+		return 0, "", false
+	}
+	start := idx + len("/models/")
+	model := p[start:]
+	if end := strings.IndexAny(model, ":/"); end >= 0 {
+		model = model[:end]
+	}
+	return start, model, model != ""
+}
+
+// setDefaultMaxTokens injects an output token cap into generation requests
+// that don't already set one. Returns true if the body was changed.
+func setDefaultMaxTokens(provider, p string, body map[string]any, maxTokens int) bool {
+	switch provider {
+	case "claude":
+		if !strings.HasPrefix(p, "/v1/messages") || strings.HasPrefix(p, "/v1/messages/") {
+			return false
+		}
+		return setIfMissing(body, maxTokens, "max_tokens")
+	case "openai":
+		switch {
+		case strings.HasPrefix(p, "/v1/responses"):
+			return setIfMissing(body, maxTokens, "max_output_tokens")
+		case strings.HasPrefix(p, "/v1/chat/completions"):
+			return setIfMissing(body, maxTokens, "max_tokens", "max_completion_tokens")
+		case strings.HasPrefix(p, "/v1/completions"):
+			return setIfMissing(body, maxTokens, "max_tokens")
+		}
+	case "gemini":
+		if !strings.Contains(p, ":generateContent") && !strings.Contains(p, ":streamGenerateContent") {
+			return false
+		}
+		gen, ok := body["generationConfig"].(map[string]any)
+		if !ok {
+			gen = make(map[string]any)
+			body["generationConfig"] = gen
+		}
+		return setIfMissing(gen, maxTokens, "maxOutputTokens")
+	}
+	return false
+}
+
+// setIfMissing sets the first key to value unless any of the keys is present
+func setIfMissing(m map[string]any, value int, keys ...string) bool {
+	for _, key := range keys {
+		if _, ok := m[key]; ok {
+			return false
+		}
+	}
+	m[keys[0]] = value
+	return true
+}
+
+// deleteField removes a dotted field path from a JSON object
+func deleteField(m map[string]any, parts []string) bool {
+	if len(parts) == 1 {
+		if _, ok := m[parts[0]]; !ok {
+			return false
+		}
+		delete(m, parts[0])
+		return true
+	}
+	child, ok := m[parts[0]].(map[string]any)
+	if !ok {
+		return false
+	}
+	return deleteField(child, parts[1:])
+}
+
+func deepCopy(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, val := range v {
+			m[k] = deepCopy(val)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, val := range v {
+			s[i] = deepCopy(val)
+		}
+		return s
+	default:
+		return v
+	}
+}
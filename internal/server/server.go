@@ -2,49 +2,141 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/llmite-ai/mirra/internal/admin"
+	"github.com/llmite-ai/mirra/internal/auth"
+	"github.com/llmite-ai/mirra/internal/ca"
 	"github.com/llmite-ai/mirra/internal/config"
+	"github.com/llmite-ai/mirra/internal/metrics"
 	"github.com/llmite-ai/mirra/internal/proxy"
 	"github.com/llmite-ai/mirra/internal/recorder"
+	"github.com/llmite-ai/mirra/internal/tracing"
 )
 
 type Server struct {
 	cfg      *config.Config
+	auth     *auth.Authenticator
 	proxy    *proxy.Proxy
 	recorder *recorder.Recorder
+	metrics  *metrics.Metrics
+	tracer   *tracing.Tracer
 }
 
-func New(cfg *config.Config) *Server {
-	rec := recorder.New(cfg.Recording.Enabled, cfg.Recording.Path)
+// New creates the server. It fails if the upstream connections can't be
+// configured.
+func New(cfg *config.Config) (*Server, error) {
+	// Metrics are only collected when the admin listener is there to serve them
+	var m *metrics.Metrics
+	if cfg.Metrics.Enabled && cfg.Admin.Enabled {
+		m = metrics.New()
+	}
+	var t *tracing.Tracer
+	if cfg.Tracing.Enabled {
+		var err error
+		if t, err = tracing.New(cfg.Tracing); err != nil {
+			slog.Error("failed to initialize tracing, tracing disabled", "error", err)
+		}
+	}
+	rec := recorder.New(cfg.Recording.Enabled, cfg.Recording.Path, m)
+
+	p, err := proxy.New(cfg, rec, m, t)
+	if err != nil {
+		rec.Close()
+		return nil, fmt.Errorf("failed to configure upstream connections: %w", err)
+	}
 
 	return &Server{
 		cfg:      cfg,
+		auth:     auth.New(cfg.Auth),
 		recorder: rec,
-		proxy:    proxy.New(cfg, rec),
-	}
+		proxy:    p,
+		metrics:  m,
+		tracer:   t,
+	}, nil
 }
 
 func (s *Server) Start(ctx context.Context) error {
 	mux := http.NewServeMux()
 
-	// Health check endpoint
+	// Health check endpoint (always unauthenticated)
 	mux.HandleFunc("/health", s.healthHandler)
 	// Catch-all for unmatched routes proxy
-	mux.HandleFunc("/{path...}", s.proxy.Handle)
+	mux.Handle("/{path...}", s.auth.Middleware(http.HandlerFunc(s.proxy.Handle)))
+
+	// CONNECT requests carry a host:port instead of a path and never reach
+	// the mux; in forward-proxy mode they are handled by the proxy directly
+	handler := http.Handler(mux)
+	if s.cfg.Forward.Enabled {
+		connect := s.auth.Middleware(http.HandlerFunc(s.proxy.HandleConnect))
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodConnect {
+				connect.ServeHTTP(w, r)
+				return
+			}
+			mux.ServeHTTP(w, r)
+		})
+	}
 
+	timeouts := s.cfg.Timeouts
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.cfg.Port),
-		Handler: mux,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(timeouts.ReadHeaderSeconds) * time.Second,
+		IdleTimeout:       time.Duration(timeouts.IdleSeconds) * time.Second,
+	}
+
+	if s.cfg.TLS.Enabled {
+		tlsConfig, err := s.tlsConfig()
+		if err != nil {
+			s.recorder.Close()
+			return err
+		}
+		srv.TLSConfig = tlsConfig
+	}
+
+	addr := s.cfg.ListenAddress()
+	ln, err := listen(addr)
+	if err != nil {
+		s.recorder.Close()
+		return err
+	}
+
+	var adminSrv *http.Server
+	if s.cfg.Admin.Enabled {
+		adminSrv, err = s.startAdmin()
+		if err != nil {
+			ln.Close()
+			s.recorder.Close()
+			return err
+		}
+	}
+
+	if s.cfg.Upstream.Prewarm {
+		go s.proxy.KeepWarm(ctx)
 	}
 
 	errChan := make(chan error, 1)
 	go func() {
-		slog.Info("𝕄𝕀ℝℝ𝔸 started", "port", s.cfg.Port)
-		errChan <- srv.ListenAndServe()
+		slog.Info("𝕄𝕀ℝℝ𝔸 started",
+			"listen", addr,
+			"tls", s.cfg.TLS.Enabled,
+			"auth", s.auth.Enabled(),
+			"forward_proxy", s.cfg.Forward.Enabled)
+		if s.cfg.TLS.Enabled {
+			// Certificates are already loaded into srv.TLSConfig
+			errChan <- srv.ServeTLS(ln, "", "")
+		} else {
+			errChan <- srv.Serve(ln)
+		}
 	}()
 
 	select {
@@ -53,22 +145,142 @@ func (s *Server) Start(ctx context.Context) error {
 		return err
 	case <-ctx.Done():
 		slog.Info("shutting down gracefully")
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		shutdownTimeout := time.Duration(timeouts.ShutdownSeconds) * time.Second
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 		defer cancel()
 
 		if err := srv.Shutdown(shutdownCtx); err != nil {
 			slog.Error("server shutdown error", "error", err)
 		}
+		if adminSrv != nil {
+			if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+				slog.Error("admin server shutdown error", "error", err)
+			}
+		}
 
 		if err := s.recorder.Close(); err != nil {
 			slog.Error("recorder close error", "error", err)
 		}
 
+		if err := s.tracer.Shutdown(shutdownCtx); err != nil {
+			slog.Error("tracer shutdown error", "error", err)
+		}
+
 		slog.Info("shutdown complete")
 		return nil
 	}
 }
 
+// startAdmin serves the admin API on its own listener
+func (s *Server) startAdmin() (*http.Server, error) {
+	ln, err := listen(s.cfg.Admin.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start admin API: %w", err)
+	}
+
+	// Metrics are served next to the API rather than on the proxy listener,
+	// which is often reachable by every client
+	var metricsHandler http.Handler
+	if s.metrics != nil {
+		metricsHandler = s.metrics.Handler()
+	}
+	api := admin.New(s.cfg.Admin, s.cfg.Recording.Path, s.recorder, metricsHandler)
+	srv := &http.Server{
+		Handler:           api,
+		ReadHeaderTimeout: time.Duration(s.cfg.Timeouts.ReadHeaderSeconds) * time.Second,
+		IdleTimeout:       time.Duration(s.cfg.Timeouts.IdleSeconds) * time.Second,
+	}
+	srv.RegisterOnShutdown(api.Close)
+	go func() {
+		slog.Info("admin API started", "listen", s.cfg.Admin.Listen, "auth", s.cfg.Admin.Token != "")
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("admin API stopped", "error", err)
+		}
+	}()
+	return srv, nil
+}
+
+// listen binds a TCP address or, with a "unix:" prefix, a Unix socket. A
+// stale socket file left behind by a previous run is removed first, but
+// only if it is a socket nothing is listening on.
+func listen(addr string) (net.Listener, error) {
+	path, isUnix := strings.CutPrefix(addr, "unix:")
+	if !isUnix {
+		return net.Listen("tcp", addr)
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check socket path: %w", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	return nil
+}
+
+// tlsConfig builds the listener TLS configuration, generating a self-signed
+// certificate when none is configured and enabling mutual TLS if a client CA
+// bundle is set
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if s.cfg.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.cfg.TLS.CertFile, s.cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	} else {
+		hosts := []string{"localhost", "127.0.0.1", "::1"}
+		if hostname, err := os.Hostname(); err == nil {
+			hosts = append(hosts, hostname)
+		}
+		cert, err := ca.SelfSigned(hosts)
+		if err != nil {
+			return nil, err
+		}
+		slog.Warn("no TLS certificate configured, using a self-signed certificate", "hosts", hosts)
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if s.cfg.TLS.ClientCAFile != "" {
+		pem, err := os.ReadFile(s.cfg.TLS.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", s.cfg.TLS.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if s.cfg.TLS.RequireClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return cfg, nil
+}
+
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
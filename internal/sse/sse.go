@@ -0,0 +1,135 @@
+// Package sse incrementally parses Server-Sent Events streams. Lines may be
+// arbitrarily long and may be split across writes at any byte, so the parser
+// can observe a stream as it is relayed without limiting or altering it.
+package sse
+
+import "strings"
+
+// Event is a single dispatched SSE event
+type Event struct {
+	// Type is the "event" field; empty means the default "message" type
+	Type string
+	ID   string
+	// Data is the concatenated "data" lines, joined by newlines
+	Data string
+}
+
+// Parser implements io.Writer and calls OnEvent for every complete event
+type Parser struct {
+	OnEvent func(Event)
+
+	line    []byte
+	lastCR  bool
+	event   Event
+	data    strings.Builder
+	hasData bool
+}
+
+// Write feeds stream bytes to the parser. It never fails.
+func (p *Parser) Write(b []byte) (int, error) {
+	n := len(b)
+
+	// A CRLF pair may straddle two writes
+	if p.lastCR && len(b) > 0 && b[0] == '\n' {
+		b = b[1:]
+	}
+	p.lastCR = false
+
+	for len(b) > 0 {
+		i := indexLineEnd(b)
+		if i < 0 {
+			p.line = append(p.line, b...)
+			break
+		}
+
+		var line []byte
+		if len(p.line) > 0 {
+			p.line = append(p.line, b[:i]...)
+			line = p.line
+		} else {
+			line = b[:i]
+		}
+		p.processLine(string(line))
+		p.line = p.line[:0]
+
+		if b[i] == '\r' {
+			if i+1 == len(b) {
+				p.lastCR = true
+			} else if b[i+1] == '\n' {
+				i++
+			}
+		}
+		b = b[i+1:]
+	}
+
+	return n, nil
+}
+
+// Close dispatches a trailing event that was not terminated by a blank line.
+// Strict SSE clients discard such an event, but it is still part of what the
+// upstream sent and is worth recording.
+func (p *Parser) Close() error {
+	if len(p.line) > 0 {
+		p.processLine(string(p.line))
+		p.line = p.line[:0]
+	}
+	p.dispatch()
+	return nil
+}
+
+func (p *Parser) processLine(line string) {
+	if line == "" {
+		p.dispatch()
+		return
+	}
+	if line[0] == ':' {
+		return // comment
+	}
+
+	field, value, _ := strings.Cut(line, ":")
+	value = strings.TrimPrefix(value, " ")
+
+	switch field {
+	case "event":
+		p.event.Type = value
+	case "data":
+		if p.hasData {
+			p.data.WriteByte('\n')
+		}
+		p.data.WriteString(value)
+		p.hasData = true
+	case "id":
+		if !strings.ContainsRune(value, 0) {
+			p.event.ID = value
+		}
+	}
+}
+
+func (p *Parser) dispatch() {
+	if p.hasData && p.OnEvent != nil {
+		p.event.Data = p.data.String()
+		p.OnEvent(p.event)
+	}
+	p.event.Type = ""
+	p.event.Data = ""
+	p.data.Reset()
+	p.hasData = false
+}
+
+func indexLineEnd(b []byte) int {
+	for i, c := range b {
+		if c == '\n' || c == '\r' {
+			return i
+		}
+	}
+	return -1
+}
+
+// Parse returns every event in a complete stream
+func Parse(stream string) []Event {
+	var events []Event
+	p := &Parser{OnEvent: func(e Event) { events = append(events, e) }}
+	p.Write([]byte(stream))
+	p.Close()
+	return events
+}
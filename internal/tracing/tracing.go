@@ -0,0 +1,203 @@
+// Package tracing exports an OpenTelemetry span for every proxied call,
+// annotated with the GenAI semantic conventions and joined to the caller's
+// trace through the traceparent header. A nil *Tracer is valid and traces
+// nothing, so callers need not check whether tracing is enabled.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/llmite-ai/mirra/internal/config"
+	"github.com/llmite-ai/mirra/internal/llm"
+	"github.com/llmite-ai/mirra/internal/recorder"
+)
+
+// systems maps providers to their gen_ai.system value
+var systems = map[string]string{
+	"claude": "anthropic",
+	"openai": "openai",
+	"gemini": "gcp.gemini",
+}
+
+type Tracer struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New creates a tracer exporting spans over OTLP/HTTP. Without a configured
+// endpoint the standard OTEL_EXPORTER_OTLP_* environment variables apply,
+// falling back to a collector on localhost:4318.
+func New(cfg config.TracingConfig) (*Tracer, error) {
+	opts := []otlptracehttp.Option{otlptracehttp.WithHeaders(cfg.Headers)}
+	if cfg.Endpoint != "" {
+		endpoint, err := url.Parse(cfg.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint: %w", err)
+		}
+		// Like OTEL_EXPORTER_OTLP_ENDPOINT, a bare collector URL gets the
+		// traces path appended
+		if endpoint.Path == "" || endpoint.Path == "/" {
+			endpoint.Path = "/v1/traces"
+		}
+		opts = append(opts, otlptracehttp.WithEndpointURL(endpoint.String()))
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName))),
+	)
+
+	return &Tracer{
+		provider:   provider,
+		tracer:     provider.Tracer("github.com/llmite-ai/mirra"),
+		propagator: propagation.TraceContext{},
+	}, nil
+}
+
+// Start begins the span for a proxied call as a child of any trace context
+// in the request headers. The returned request carries the span; Finish or
+// End must be called with its context.
+func (t *Tracer) Start(r *http.Request) *http.Request {
+	if t == nil {
+		return r
+	}
+
+	ctx := t.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, _ = t.tracer.Start(ctx, r.Method+" "+llm.Route(r.URL.Path), trace.WithSpanKind(trace.SpanKindServer))
+	return r.WithContext(ctx)
+}
+
+// Inject sets the traceparent of the span in ctx on an upstream request, so
+// the upstream call is attributed to the MIRRA span
+func (t *Tracer) Inject(ctx context.Context, header http.Header) {
+	if t == nil {
+		return
+	}
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// Finish names the span in ctx after the call, sets its attributes from the
+// finished recording and ends it when the exchange completed. It may run
+// after the request has been served.
+func (t *Tracer) Finish(ctx context.Context, rec *recorder.Recording) {
+	if t == nil {
+		return
+	}
+	span := trace.SpanFromContext(ctx)
+	defer span.End(trace.WithTimestamp(rec.Timing.CompletedAt))
+	if !span.IsRecording() {
+		return
+	}
+
+	operation := llm.Operation(rec.Provider, rec.Request.Path)
+	switch {
+	case operation != "" && rec.Model != "":
+		span.SetName(operation + " " + rec.Model)
+	case operation != "":
+		span.SetName(operation)
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("gen_ai.system", systems[rec.Provider]),
+		attribute.String("gen_ai.provider.name", systems[rec.Provider]),
+		attribute.String("http.request.method", rec.Request.Method),
+		attribute.String("url.path", rec.Request.Path),
+		attribute.Int("http.response.status_code", rec.Response.Status),
+		attribute.String("mirra.recording_id", rec.ID),
+		attribute.String("mirra.outcome", rec.Outcome),
+		attribute.Int64("mirra.bytes_delivered", rec.BytesDelivered),
+	}
+	if operation != "" {
+		attrs = append(attrs, attribute.String("gen_ai.operation.name", operation))
+	}
+	if rec.Model != "" {
+		attrs = append(attrs, attribute.String("gen_ai.request.model", rec.Model))
+	}
+	if model := responseModel(rec.Response); model != "" {
+		attrs = append(attrs, attribute.String("gen_ai.response.model", model))
+	}
+	if rec.Usage != nil {
+		attrs = append(attrs,
+			attribute.Int64("gen_ai.usage.input_tokens", rec.Usage.InputTokens),
+			attribute.Int64("gen_ai.usage.output_tokens", rec.Usage.OutputTokens))
+	}
+	if rec.Client != "" {
+		attrs = append(attrs, attribute.String("mirra.client", rec.Client))
+	}
+	if rec.CacheHit {
+		attrs = append(attrs, attribute.Bool("mirra.cache_hit", true))
+	}
+	if rec.RateLimited {
+		attrs = append(attrs, attribute.Bool("mirra.rate_limited", true))
+	}
+	span.SetAttributes(attrs...)
+
+	// Server spans only count 5xx responses and failed relays as errors
+	switch {
+	case rec.Outcome == recorder.OutcomeUpstreamError || rec.Outcome == recorder.OutcomeTimeout:
+		errorType := rec.ErrorKind
+		if errorType == "" {
+			errorType = rec.Outcome
+		}
+		span.SetAttributes(attribute.String("error.type", errorType))
+		span.SetStatus(codes.Error, rec.Error)
+	case rec.Response.Status >= 500:
+		span.SetAttributes(attribute.String("error.type", strconv.Itoa(rec.Response.Status)))
+		span.SetStatus(codes.Error, "")
+	}
+}
+
+// End ends the span in ctx, for calls that fail before they are recorded
+func (t *Tracer) End(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	trace.SpanFromContext(ctx).End()
+}
+
+// Shutdown exports any buffered spans
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.provider.Shutdown(ctx)
+}
+
+// responseModel reads the model that served a response, from the
+// reassembled body of a streamed one
+func responseModel(resp recorder.ResponseData) string {
+	body := resp.Body
+	if resp.Reassembled != nil {
+		body = resp.Reassembled
+	}
+	m, ok := body.(map[string]any)
+	if !ok {
+		return ""
+	}
+	for _, key := range []string{"model", "modelVersion"} {
+		if model, ok := m[key].(string); ok {
+			return model
+		}
+	}
+	return ""
+}
@@ -0,0 +1,225 @@
+// Package websocket parses WebSocket (RFC 6455) frames out of a relayed byte
+// stream so they can be recorded. It only observes traffic; the bytes are
+// relayed unchanged by the caller.
+package websocket
+
+import (
+	"encoding/binary"
+	"net/http"
+	"strings"
+)
+
+// Opcodes
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+// IsUpgrade reports whether r asks to switch to the WebSocket protocol
+func IsUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") &&
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OpcodeName returns a readable name for a frame opcode
+func OpcodeName(opcode byte) string {
+	switch opcode {
+	case OpContinuation:
+		return "continuation"
+	case OpText:
+		return "text"
+	case OpBinary:
+		return "binary"
+	case OpClose:
+		return "close"
+	case OpPing:
+		return "ping"
+	case OpPong:
+		return "pong"
+	default:
+		return "unknown"
+	}
+}
+
+// DefaultMaxPayload is the payload limit of a Parser without MaxPayload
+const DefaultMaxPayload = 16 << 20
+
+// Frame is a parsed frame, or a whole message joined from a fragmented one.
+// Payload is unmasked, and nil if the payload was larger than the parser's
+// limit, in which case Truncated is set.
+type Frame struct {
+	Fin       bool
+	Opcode    byte
+	Length    int64
+	Payload   []byte
+	Truncated bool
+}
+
+// Parser implements io.Writer and calls OnFrame for every complete control
+// frame and message. A message fragmented over continuation frames is
+// passed on once its final frame arrives, as one Frame with the first
+// frame's opcode. Payloads over MaxPayload bytes (DefaultMaxPayload if 0)
+// are skipped rather than buffered.
+type Parser struct {
+	OnFrame    func(Frame)
+	MaxPayload int64
+
+	buf     []byte
+	skip    int64  // payload bytes of an oversized frame still to discard
+	message *Frame // a fragmented message awaiting its final frame
+}
+
+// Write feeds stream bytes to the parser. It never fails.
+func (p *Parser) Write(b []byte) (int, error) {
+	n := len(b)
+
+	if p.skip > 0 {
+		if int64(len(b)) <= p.skip {
+			p.skip -= int64(len(b))
+			return n, nil
+		}
+		b = b[p.skip:]
+		p.skip = 0
+	}
+
+	p.buf = append(p.buf, b...)
+	for p.next() {
+	}
+	return n, nil
+}
+
+// next parses one frame from the buffer, returning false if more bytes are
+// needed
+func (p *Parser) next() bool {
+	if len(p.buf) < 2 {
+		return false
+	}
+
+	fin := p.buf[0]&0x80 != 0
+	opcode := p.buf[0] & 0x0f
+	masked := p.buf[1]&0x80 != 0
+	length := int64(p.buf[1] & 0x7f)
+
+	header := 2
+	switch length {
+	case 126:
+		if len(p.buf) < 4 {
+			return false
+		}
+		length = int64(binary.BigEndian.Uint16(p.buf[2:4]))
+		header = 4
+	case 127:
+		if len(p.buf) < 10 {
+			return false
+		}
+		length = int64(binary.BigEndian.Uint64(p.buf[2:10]) & (1<<63 - 1))
+		header = 10
+	}
+
+	var mask []byte
+	if masked {
+		if len(p.buf) < header+4 {
+			return false
+		}
+		mask = p.buf[header : header+4]
+		header += 4
+	}
+
+	frame := Frame{Fin: fin, Opcode: opcode, Length: length}
+
+	if length > p.maxPayload() {
+		frame.Truncated = true
+		available := int64(len(p.buf) - header)
+		if available >= length {
+			p.buf = p.buf[header+int(length):]
+		} else {
+			p.skip = length - available
+			p.buf = p.buf[:0]
+		}
+		p.deliver(frame)
+		return p.skip == 0
+	}
+
+	if int64(len(p.buf)-header) < length {
+		return false
+	}
+
+	payload := make([]byte, length)
+	copy(payload, p.buf[header:header+int(length)])
+	if mask != nil {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	frame.Payload = payload
+
+	p.buf = p.buf[header+int(length):]
+	p.deliver(frame)
+	return true
+}
+
+func (p *Parser) maxPayload() int64 {
+	if p.MaxPayload > 0 {
+		return p.MaxPayload
+	}
+	return DefaultMaxPayload
+}
+
+// deliver passes control frames and unfragmented messages on, and joins the
+// frames of a fragmented message until its final frame. Control frames may
+// arrive between the fragments.
+func (p *Parser) deliver(f Frame) {
+	switch {
+	case f.Opcode >= OpClose:
+		p.emit(f)
+	case f.Opcode == OpContinuation && p.message != nil:
+		m := p.message
+		m.Length += f.Length
+		if m.Truncated || f.Truncated || m.Length > p.maxPayload() {
+			m.Truncated = true
+			m.Payload = nil
+		} else {
+			m.Payload = append(m.Payload, f.Payload...)
+		}
+		if f.Fin {
+			m.Fin = true
+			p.message = nil
+			p.emit(*m)
+		}
+	case f.Opcode == OpContinuation:
+		// A continuation without a message to continue is passed on as is
+		p.emit(f)
+	default:
+		if p.message != nil {
+			// The peer started a new message without finishing the last
+			p.emit(*p.message)
+			p.message = nil
+		}
+		if f.Fin {
+			p.emit(f)
+		} else {
+			p.message = &f
+		}
+	}
+}
+
+func (p *Parser) emit(f Frame) {
+	if p.OnFrame != nil {
+		p.OnFrame(f)
+	}
+}
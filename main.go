@@ -46,6 +46,21 @@ func main() {
 			slog.Error("view failed", "error", err)
 			os.Exit(1)
 		}
+	case "search":
+		if err := commands.Search(args); err != nil {
+			slog.Error("search failed", "error", err)
+			os.Exit(1)
+		}
+	case "tail":
+		if err := commands.Tail(args); err != nil {
+			slog.Error("tail failed", "error", err)
+			os.Exit(1)
+		}
+	case "ca":
+		if err := commands.CA(args); err != nil {
+			slog.Error("ca failed", "error", err)
+			os.Exit(1)
+		}
 	case "help", "-h", "--help":
 		printUsage()
 	default:
@@ -58,6 +73,7 @@ func main() {
 func startCommand(args []string) {
 	fs := flag.NewFlagSet("start", flag.ExitOnError)
 	port := fs.Int("port", 0, "Port to listen on")
+	listen := fs.String("listen", "", "Address to listen on (host:port or unix:/path)")
 	configPath := fs.String("config", "", "Path to config file")
 
 	if err := fs.Parse(args); err != nil {
@@ -71,15 +87,22 @@ func startCommand(args []string) {
 		os.Exit(1)
 	}
 
+	if *listen != "" {
+		cfg.Listen = *listen
+	}
 	if *port != 0 {
-		cfg.Port = *port
+		cfg.SetPort(*port)
 	}
 
 	// Reinitialize logger with config settings
 	log := logger.NewLogger(cfg.Logging.Format, cfg.Logging.Level, os.Stdout)
 	slog.SetDefault(log)
 
-	srv := server.New(cfg)
+	srv, err := server.New(cfg)
+	if err != nil {
+		slog.Error("failed to start", "error", err)
+		os.Exit(1)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -103,10 +126,13 @@ func printUsage() {
 	usage := `MIRRA - Monitoring & Inspection Recording Relay Archive
 
 Usage:
-  mirra start [--port 4567] [--config ./config.json]
-  mirra export [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--provider claude|openai|gemini] [--output file.jsonl]
-  mirra stats [--from YYYY-MM-DD] [--provider claude|openai|gemini]
-  mirra view <recording-id>
+  mirra start [--port 4567] [--listen host:port|unix:/path] [--config ./config.json]
+  mirra export [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--provider claude|openai|gemini] [--where expr] [--output file.jsonl]
+  mirra stats [--from YYYY-MM-DD] [--provider claude|openai|gemini] [--where expr]
+  mirra view [--transcript] [--where expr] [recording-id]
+  mirra search [--in request|response|both] [--regex] [--where expr] "text"
+  mirra tail [--admin 127.0.0.1:4568] [--provider claude|openai|gemini] [--model name] [--status 4xx] [--where expr]
+  mirra ca [--config config.json] [--dir ./ca] [--export ca.pem] [--regenerate]
   mirra help
 
 Commands:
@@ -114,6 +140,15 @@ Commands:
   export  - Export recordings to a file
   stats   - Show statistics about recordings
   view    - View a specific recording
-  help    - Show this help message`
+  search  - Search the text of prompts and completions
+  tail    - Follow recordings live through the admin API
+  ca      - Generate and export the local CA used by forward-proxy mode
+  help    - Show this help message
+
+Filter expressions (--where):
+  status>=400 and model~"claude-*" and body contains "refund"
+  = and != compare strings exactly, including case; ~ and !~ (globs with * and ?)
+  and contains ignore case. --provider, --model and --status are shorthands for
+  provider=..., model=... and status=... comparisons.`
 	fmt.Fprintln(os.Stdout, usage)
 }